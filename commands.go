@@ -0,0 +1,17 @@
+package main
+
+import (
+	"osdapp/firmware"
+	"osdapp/internal/cli"
+)
+
+// runCommand runs the headless command given in args, without
+// starting the GUI, and returns the exit code.
+func runCommand(args []string) int {
+	// Only the storage is used, so there's no need for newApp()
+	a := &App{}
+	return cli.Run(args, &cli.Options{
+		FirmwareSources: a.firmwareSources,
+		FirmwareCache:   firmware.NewCache(a.storagePath(firmwareCacheDir)),
+	})
+}
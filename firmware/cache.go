@@ -0,0 +1,452 @@
+package firmware
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheManifestFile = "manifest.json"
+	cacheSourceName   = "cache"
+
+	maxChecksumSize = 4096
+)
+
+// CacheEntry represents a verified firmware stored in a Cache
+type CacheEntry struct {
+	Filename        string    `json:"filename"`
+	URL             string    `json:"url"`
+	ReleaseNotesURL string    `json:"release_notes_url,omitempty"`
+	Source          string    `json:"source,omitempty"`
+	Size            int64     `json:"size"`
+	SHA256          string    `json:"sha256"`
+	Added           time.Time `json:"added"`
+}
+
+// Cache stores downloaded firmwares in a directory, keeping
+// a manifest with their sizes and SHA-256 digests. Firmwares
+// are only added to the cache after they've been verified
+// and are verified again every time they're opened.
+//
+// Cache also implements the Source interface, returning the
+// firmwares stored in it.
+type Cache struct {
+	Dir string
+	// mu protects the manifest and the files map
+	mu sync.Mutex
+	// files contains a lock for each filename, held while
+	// downloading the firmware or its release notes
+	files map[string]*sync.Mutex
+}
+
+var _ Source = (*Cache)(nil)
+
+// NewCache returns a *Cache that stores its data in dir
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+func (c *Cache) manifestPath() string {
+	return filepath.Join(c.Dir, cacheManifestFile)
+}
+
+func (c *Cache) readManifest() (map[string]*CacheEntry, error) {
+	entries := make(map[string]*CacheEntry)
+	data, err := ioutil.ReadFile(c.manifestPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *Cache) writeManifest(entries map[string]*CacheEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.manifestPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.manifestPath())
+}
+
+// verify checks that the stored file matches the entry
+func (c *Cache) verify(entry *CacheEntry) error {
+	p := filepath.Join(c.Dir, entry.Filename)
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != entry.Size {
+		return fmt.Errorf("cached firmware %s has %d bytes, expecting %d", entry.Filename, n, entry.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != entry.SHA256 {
+		return fmt.Errorf("cached firmware %s has SHA-256 %s, expecting %s", entry.Filename, sum, entry.SHA256)
+	}
+	return nil
+}
+
+// Entries returns the verified entries in the cache. Entries
+// that fail verification are ignored.
+func (c *Cache) Entries() ([]*CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	var valid []*CacheEntry
+	for _, e := range entries {
+		if err := c.verify(e); err != nil {
+			log.Printf("ignoring cached firmware: %v", err)
+			continue
+		}
+		valid = append(valid, e)
+	}
+	return valid, nil
+}
+
+// Name implements the Source interface
+func (c *Cache) Name() string {
+	return cacheSourceName
+}
+
+// Firmwares implements the Source interface
+func (c *Cache) Firmwares(ctx context.Context) ([]*Firmware, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var firmwares []*Firmware
+	for _, e := range entries {
+		f := &Firmware{
+			URL:             fileURL(filepath.Join(c.Dir, e.Filename)),
+			ReleaseNotesURL: e.ReleaseNotesURL,
+			Source:          c.Name(),
+			Size:            e.Size,
+			SHA256:          e.SHA256,
+		}
+		if _, err := f.Version(); err != nil {
+			continue
+		}
+		if _, err := f.Date(); err != nil {
+			continue
+		}
+		if notes := c.releaseNotesPath(e.Filename); fileExists(notes) {
+			f.ReleaseNotesURL = fileURL(notes)
+		}
+		firmwares = append(firmwares, f)
+	}
+	sortFirmwares(firmwares)
+	return firmwares, nil
+}
+
+// Open returns a reader for the given firmware, downloading
+// and verifying it if it's not in the cache yet.
+func (c *Cache) Open(ctx context.Context, f *Firmware) (io.ReadCloser, error) {
+	p, err := c.Get(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// fileLock returns the lock for the given filename
+func (c *Cache) fileLock(filename string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = make(map[string]*sync.Mutex)
+	}
+	l := c.files[filename]
+	if l == nil {
+		l = &sync.Mutex{}
+		c.files[filename] = l
+	}
+	return l
+}
+
+// Get returns the path to the given firmware in the cache,
+// downloading and verifying it if needed. Cached files are
+// only used if they match the SHA-256 or, if there's none,
+// the blob SHA of f.
+func (c *Cache) Get(ctx context.Context, f *Firmware) (string, error) {
+	filename, err := f.Filename()
+	if err != nil {
+		return "", err
+	}
+	// Download each file once, without blocking the rest
+	// of the cache
+	l := c.fileLock(filename)
+	l.Lock()
+	defer l.Unlock()
+	found, err := c.lookup(f, filename)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return filepath.Join(c.Dir, filename), nil
+	}
+	entry, err := c.download(ctx, f, filename)
+	if err != nil {
+		return "", err
+	}
+	if err := c.addEntry(entry); err != nil {
+		return "", err
+	}
+	if f.ReleaseNotesURL != "" {
+		if _, err := c.releaseNotes(ctx, f, filename); err != nil {
+			log.Printf("could not cache release notes for %s: %v", filename, err)
+		}
+	}
+	return filepath.Join(c.Dir, filename), nil
+}
+
+// lookup returns true if f is in the cache with the expected
+// checksums. Otherwise, the cached file must be downloaded
+// again. If f was listed from the cache, it can't be downloaded
+// and an error is returned instead.
+func (c *Cache) lookup(f *Firmware, filename string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.readManifest()
+	if err != nil {
+		return false, err
+	}
+	e := entries[filename]
+	if e == nil {
+		return false, nil
+	}
+	err = c.verify(e)
+	if err == nil {
+		err = c.checkDigests(e, f)
+	}
+	if err == nil {
+		return true, nil
+	}
+	if f.Source == c.Name() {
+		// f points to the cached file, downloading it
+		// again would read the same data
+		return false, err
+	}
+	log.Printf("discarding cached firmware %s: %v", filename, err)
+	return false, nil
+}
+
+// checkDigests returns an error if the cached entry doesn't match
+// the SHA-256 of f or, if it has none, its blob SHA. The latter
+// detects assets uploaded again with the same name.
+func (c *Cache) checkDigests(e *CacheEntry, f *Firmware) error {
+	if f.SHA256 != "" {
+		if !strings.EqualFold(f.SHA256, e.SHA256) {
+			return fmt.Errorf("cached firmware %s has SHA-256 %s, expecting %s", e.Filename, e.SHA256, f.SHA256)
+		}
+		return nil
+	}
+	if f.GitBlobSHA != "" {
+		sum, err := gitBlobSHA(filepath.Join(c.Dir, e.Filename), e.Size)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, f.GitBlobSHA) {
+			return fmt.Errorf("cached firmware %s has blob SHA %s, expecting %s", e.Filename, sum, f.GitBlobSHA)
+		}
+	}
+	return nil
+}
+
+// addEntry adds the entry to the manifest, replacing any
+// previous one with the same filename
+func (c *Cache) addEntry(entry *CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.readManifest()
+	if err != nil {
+		return err
+	}
+	entries[entry.Filename] = entry
+	return c.writeManifest(entries)
+}
+
+// ReleaseNotes returns the release notes for the given firmware in
+// Markdown format. Notes are stored in the cache the first time
+// they're retrieved, so they're available offline afterwards.
+func (c *Cache) ReleaseNotes(ctx context.Context, f *Firmware) (string, error) {
+	filename, err := f.Filename()
+	if err != nil {
+		return "", err
+	}
+	l := c.fileLock(filename)
+	l.Lock()
+	defer l.Unlock()
+	return c.releaseNotes(ctx, f, filename)
+}
+
+func (c *Cache) releaseNotesPath(filename string) string {
+	nonExt := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return filepath.Join(c.Dir, nonExt+firmwareNotesExtension)
+}
+
+func (c *Cache) releaseNotes(ctx context.Context, f *Firmware, filename string) (string, error) {
+	p := c.releaseNotesPath(filename)
+	if data, err := ioutil.ReadFile(p); err == nil {
+		return string(data), nil
+	}
+	notes, err := f.ReleaseNotes(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(notes), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", err
+	}
+	return notes, nil
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// download retrieves the firmware into a temporary file, verifying
+// it before moving it into the cache.
+func (c *Cache) download(ctx context.Context, f *Firmware, filename string) (*CacheEntry, error) {
+	expectedSHA256 := f.SHA256
+	if expectedSHA256 == "" && f.ChecksumURL != "" {
+		sum, err := f.fetchChecksum(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve checksum for %s: %v", filename, err)
+		}
+		expectedSHA256 = sum
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, ".download-")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	r, err := f.Open(ctx)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	r.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Size > 0 && n != f.Size {
+		return nil, fmt.Errorf("downloaded firmware %s has %d bytes, expecting %d", filename, n, f.Size)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(sum, expectedSHA256) {
+		return nil, fmt.Errorf("downloaded firmware %s has SHA-256 %s, expecting %s", filename, sum, expectedSHA256)
+	}
+	if f.GitBlobSHA != "" {
+		blobSum, err := gitBlobSHA(tmpName, n)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(blobSum, f.GitBlobSHA) {
+			return nil, fmt.Errorf("downloaded firmware %s has blob SHA %s, expecting %s", filename, blobSum, f.GitBlobSHA)
+		}
+	}
+	if expectedSHA256 == "" && f.GitBlobSHA == "" {
+		log.Printf("no checksum available for %s, caching it with SHA-256 %s", filename, sum)
+	}
+	if err := os.Rename(tmpName, filepath.Join(c.Dir, filename)); err != nil {
+		return nil, err
+	}
+	return &CacheEntry{
+		Filename:        filename,
+		URL:             f.URL,
+		ReleaseNotesURL: f.ReleaseNotesURL,
+		Source:          f.Source,
+		Size:            n,
+		SHA256:          sum,
+		Added:           time.Now().UTC(),
+	}, nil
+}
+
+// fetchChecksum retrieves the SHA-256 digest from the sidecar file
+// at f.ChecksumURL, in the format used by sha256sum.
+func (f *Firmware) fetchChecksum(ctx context.Context) (string, error) {
+	r, err := (&Firmware{URL: f.ChecksumURL}).Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxChecksumSize))
+	if err != nil {
+		return "", err
+	}
+	return parseChecksum(string(data))
+}
+
+func parseChecksum(s string) (string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum file")
+	}
+	sum := strings.ToLower(fields[0])
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q", fields[0])
+	}
+	return sum, nil
+}
+
+// gitBlobSHA returns the SHA-1 used by git to identify the
+// contents of the given file, which GitHub reports for each
+// file in a repository.
+func gitBlobSHA(filename string, size int64) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,269 @@
+package firmware
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFirmwareName = "FrSkyOSD-v1.0.0_20191025.bin"
+	testNotesName    = "FrSkyOSD-v1.0.0_20191025.md"
+	testReleaseNotes = "# 1.0.0\n\n- First release\n"
+)
+
+func testCache(t *testing.T) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "firmware-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCache(dir), func() { os.RemoveAll(dir) }
+}
+
+func testFirmwareServer(data []byte, checksum string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch filepath.Base(r.URL.Path) {
+		case testFirmwareName:
+			w.Write(data)
+		case testFirmwareName + firmwareChecksumExtension:
+			fmt.Fprintf(w, "%s  %s\n", checksum, testFirmwareName)
+		case testNotesName:
+			fmt.Fprint(w, testReleaseNotes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCacheGet(t *testing.T) {
+	cache, cleanup := testCache(t)
+	defer cleanup()
+
+	data := []byte("firmware data")
+	srv := testFirmwareServer(data, sha256Hex(data))
+	defer srv.Close()
+
+	f := &Firmware{
+		URL:         srv.URL + "/" + testFirmwareName,
+		ChecksumURL: srv.URL + "/" + testFirmwareName + firmwareChecksumExtension,
+	}
+	p, err := cache.Get(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := ioutil.ReadFile(p)
+	assert.NoError(t, err)
+	assert.Equal(t, data, cached)
+
+	// Firmwares in the cache must be available without network
+	srv.Close()
+	firmwares, err := cache.Firmwares(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmwares, 1) {
+		assert.Equal(t, cacheSourceName, firmwares[0].Source)
+		r, err := cache.Open(context.Background(), firmwares[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		cached, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, data, cached)
+	}
+
+	// Corrupted files must be ignored
+	assert.NoError(t, ioutil.WriteFile(p, []byte("corrupted"), 0644))
+	cachedFirmware := firmwares[0]
+	firmwares, err = cache.Firmwares(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, firmwares, 0)
+
+	// Firmwares listed from the cache can't be repaired
+	_, err = cache.Get(context.Background(), cachedFirmware)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cached firmware "+testFirmwareName)
+	}
+}
+
+func TestCacheChecksumMismatch(t *testing.T) {
+	cache, cleanup := testCache(t)
+	defer cleanup()
+
+	data := []byte("firmware data")
+	srv := testFirmwareServer(data[:len(data)-1], sha256Hex(data))
+	defer srv.Close()
+
+	f := &Firmware{
+		URL:         srv.URL + "/" + testFirmwareName,
+		ChecksumURL: srv.URL + "/" + testFirmwareName + firmwareChecksumExtension,
+	}
+	_, err := cache.Get(context.Background(), f)
+	assert.Error(t, err)
+
+	f = &Firmware{
+		URL:  srv.URL + "/" + testFirmwareName,
+		Size: int64(len(data)),
+	}
+	_, err = cache.Get(context.Background(), f)
+	assert.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(cache.Dir, testFirmwareName))
+	assert.True(t, os.IsNotExist(err))
+	entries, err := cache.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestCacheGitBlobSHA(t *testing.T) {
+	cache, cleanup := testCache(t)
+	defer cleanup()
+
+	data := []byte("hello world\n")
+	srv := testFirmwareServer(data, "")
+	defer srv.Close()
+
+	f := &Firmware{
+		URL: srv.URL + "/" + testFirmwareName,
+		// git hash-object of "hello world\n"
+		GitBlobSHA: "3b18e512dba79e4c8300dd08aeb37f8e728b8dad",
+		Size:       int64(len(data)),
+	}
+	_, err := cache.Get(context.Background(), f)
+	assert.NoError(t, err)
+
+	cache2, cleanup2 := testCache(t)
+	defer cleanup2()
+	f.GitBlobSHA = "0000000000000000000000000000000000000000"
+	_, err = cache2.Get(context.Background(), f)
+	assert.Error(t, err)
+
+	// An asset uploaded again with the same name must not
+	// be served from the cache
+	srv.Close()
+	data = []byte("hello again\n")
+	srv = testFirmwareServer(data, "")
+	defer srv.Close()
+	f = &Firmware{
+		URL:        srv.URL + "/" + testFirmwareName,
+		GitBlobSHA: gitBlobSHAHex(data),
+		Size:       int64(len(data)),
+	}
+	p, err := cache.Get(context.Background(), f)
+	if assert.NoError(t, err) {
+		cached, err := ioutil.ReadFile(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, cached)
+	}
+}
+
+func gitBlobSHAHex(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestCacheGetDoesNotBlock(t *testing.T) {
+	cache, cleanup := testCache(t)
+	defer cleanup()
+
+	data := []byte("firmware data")
+	requested := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-release
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(context.Background(), &Firmware{URL: srv.URL + "/" + testFirmwareName})
+		done <- err
+	}()
+	<-requested
+	// Listing the cache must not wait for the download
+	listed := make(chan error, 1)
+	go func() {
+		_, err := cache.Entries()
+		listed <- err
+	}()
+	select {
+	case err := <-listed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("Entries blocked by a download")
+	}
+	close(release)
+	assert.NoError(t, <-done)
+	entries, err := cache.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCacheReleaseNotes(t *testing.T) {
+	cache, cleanup := testCache(t)
+	defer cleanup()
+
+	data := []byte("firmware data")
+	srv := testFirmwareServer(data, sha256Hex(data))
+	defer srv.Close()
+
+	f := &Firmware{
+		URL:             srv.URL + "/" + testFirmwareName,
+		ReleaseNotesURL: srv.URL + "/" + testNotesName,
+	}
+	if _, err := cache.Get(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notes must be available offline once the firmware is cached
+	srv.Close()
+	notes, err := cache.ReleaseNotes(context.Background(), f)
+	assert.NoError(t, err)
+	assert.Equal(t, testReleaseNotes, notes)
+
+	firmwares, err := cache.Firmwares(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmwares, 1) {
+		notes, err := firmwares[0].ReleaseNotes(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, testReleaseNotes, notes)
+	}
+
+	_, err = cache.ReleaseNotes(context.Background(), &Firmware{URL: srv.URL + "/FrSkyOSD-v2.0.0_20200101.bin"})
+	assert.Error(t, err)
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256Hex([]byte("data"))
+	parsed, err := parseChecksum(sum + "  file.bin\n")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, parsed)
+
+	_, err = parseChecksum("")
+	assert.Error(t, err)
+	_, err = parseChecksum("abcd file.bin")
+	assert.Error(t, err)
+}
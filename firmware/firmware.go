@@ -4,29 +4,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
-
+	"osdapp/internal/httpclient"
 	"osdapp/internal/osdversion"
 )
 
 const (
 	firmwareExtension            = ".bin"
 	firmwareNotesExtension       = ".md"
+	firmwareChecksumExtension    = ".sha256"
 	firmwarePrefix               = "FrSkyOSD-v"
 	firmwareVersionDateSeparator = "_"
-	firmwareSourceURL            = "https://github.com/FrSkyRC/PixelOSD/firmware"
+
+	maxReleaseNotesSize = 256 * 1024
 )
 
 var (
 	errMissingSeparator = errors.New("missing version-date separator")
+	errNoReleaseNotes   = errors.New("no release notes available")
 )
 
 // Firmware represents an available firmware with its
@@ -34,6 +40,20 @@ var (
 type Firmware struct {
 	URL             string
 	ReleaseNotesURL string
+	// Source is the name of the Source this firmware
+	// was retrieved from
+	Source string
+	// Size is the expected size in bytes, zero if unknown
+	Size int64
+	// SHA256 is the expected hex encoded SHA-256 digest,
+	// empty if unknown
+	SHA256 string
+	// ChecksumURL is the URL of a sidecar file with the
+	// SHA-256 digest in the format used by sha256sum
+	ChecksumURL string
+	// GitBlobSHA is the SHA-1 used by git to identify the file,
+	// as reported by GitHub
+	GitBlobSHA string
 }
 
 // Filename returns the filename of the firmware
@@ -50,9 +70,9 @@ func (f *Firmware) basename() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if filepath.Ext(name) != firmwareExtension {
-		return "", fmt.Errorf("firmware file %q has incorrect extension %q instead of %q",
-			name, filepath.Ext(name), firmwareExtension)
+	if !IsFirmwareFilename(name) {
+		return "", fmt.Errorf("firmware file %q has incorrect extension %q instead of one of %s",
+			name, filepath.Ext(name), strings.Join(FileExtensions, ", "))
 	}
 	if !strings.HasPrefix(name, firmwarePrefix) {
 		return "", fmt.Errorf("filename %q doesn't look like a valid firmware", name)
@@ -60,31 +80,32 @@ func (f *Firmware) basename() (string, error) {
 	return name, nil
 }
 
-func (f *Firmware) version() (major, minor, patch int, err error) {
+// Version returns the version as parsed from the filename
+func (f *Firmware) Version() (osdversion.Version, error) {
 	name, err := f.basename()
 	if err != nil {
-		return -1, -1, -1, err
+		return osdversion.Version{}, err
 	}
 	nonPrefix := name[len(firmwarePrefix):]
 	sep := strings.Index(nonPrefix, firmwareVersionDateSeparator)
 	if sep < 0 {
-		return -1, -1, -1, errMissingSeparator
+		return osdversion.Version{}, errMissingSeparator
 	}
-	version := nonPrefix[:sep]
-	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
-		return -1, -1, -1, err
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(nonPrefix[:sep], "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return osdversion.Version{}, err
 	}
-	return major, minor, patch, nil
+	return osdversion.New(major, minor, patch), nil
 }
 
 // VersionName returns the version name that should
 // be display to the user
 func (f *Firmware) VersionName() (string, error) {
-	major, minor, patch, err := f.version()
+	v, err := f.Version()
 	if err != nil {
 		return "", err
 	}
-	return osdversion.Format(major, minor, patch), nil
+	return v.String(), nil
 }
 
 // Date returns the release date as parsed from the filename
@@ -104,49 +125,114 @@ func (f *Firmware) Date() (time.Time, error) {
 	return time.Parse("20060102", date)
 }
 
-// Load checks the available firmwares in GitHub and
-// returns their URLs
-func Load() ([]*Firmware, error) {
-	u, err := url.Parse(firmwareSourceURL)
+// Open returns a reader for the firmware data. Both remote and
+// file:// URLs are supported.
+func (f *Firmware) Open(ctx context.Context) (io.ReadCloser, error) {
+	u, err := url.Parse(f.URL)
 	if err != nil {
 		return nil, err
 	}
-	if u.Hostname() != "github.com" {
-		return nil, fmt.Errorf("host is %q instead of github.com", u.Hostname())
+	if u.Scheme == "file" {
+		return os.Open(urlFilePath(u))
 	}
-	parts := strings.Split(u.Path[1:], "/")
-	repoPath := strings.Join(parts[2:], "/")
-	c := github.NewClient(nil)
-	_, dirContents, _, err := c.Repositories.GetContents(context.Background(), parts[0], parts[1], repoPath, nil)
+	req, err := http.NewRequest("GET", f.URL, nil)
 	if err != nil {
 		return nil, err
 	}
-	candidates := make(map[string]string)
+	resp, err := httpclient.Default().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid HTTP response code %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// ReleaseNotes retrieves the release notes in Markdown format
+func (f *Firmware) ReleaseNotes(ctx context.Context) (string, error) {
+	if f.ReleaseNotesURL == "" {
+		return "", errNoReleaseNotes
+	}
+	r, err := (&Firmware{URL: f.ReleaseNotesURL}).Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxReleaseNotesSize))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Load checks the available firmwares in the default
+// sources and returns them. See LoadFrom.
+func Load() ([]*Firmware, error) {
+	return LoadFrom(context.Background(), DefaultSources())
+}
+
+// LoadFrom checks the available firmwares in all the given sources
+// and returns them with the newest version first. Firmwares with the
+// same version are deduplicated, keeping the one from the first source.
+// An error is returned only if all the sources fail.
+func LoadFrom(ctx context.Context, sources []Source) ([]*Firmware, error) {
 	var firmwares []*Firmware
-	for _, entry := range dirContents {
-		filename := entry.GetName()
-		ext := strings.ToLower(filepath.Ext(filename))
-		switch ext {
-		case firmwareExtension:
-			candidates[filename] = entry.GetDownloadURL()
-		case firmwareNotesExtension:
-			candidates[filename] = entry.GetHTMLURL()
+	seen := make(map[osdversion.Version]bool)
+	var errs []string
+	for _, src := range sources {
+		sourceFirmwares, err := src.Firmwares(ctx)
+		if err != nil {
+			log.Printf("error loading firmwares from %s: %v", src.Name(), err)
+			errs = append(errs, fmt.Sprintf("%s: %v", src.Name(), err))
+			continue
 		}
+		for _, f := range sourceFirmwares {
+			vers, err := f.Version()
+			if err != nil {
+				continue
+			}
+			if seen[vers] {
+				continue
+			}
+			seen[vers] = true
+			firmwares = append(firmwares, f)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(sources) {
+		return nil, errors.New(strings.Join(errs, "\n"))
 	}
-	for k, v := range candidates {
-		ext := strings.ToLower(filepath.Ext(k))
-		if ext != firmwareExtension {
+	sortFirmwares(firmwares)
+	return firmwares, nil
+}
+
+// firmwaresFromFiles builds the list of firmwares from a set of files,
+// keyed by filename, with their values being the URL to use for each
+// file. If requireNotes is true, firmwares without release notes are
+// ignored.
+func firmwaresFromFiles(files map[string]string, source string, requireNotes bool) []*Firmware {
+	var firmwares []*Firmware
+	for k, v := range files {
+		if !IsFirmwareFilename(k) {
 			continue
 		}
+		ext := filepath.Ext(k)
 		nonExt := k[:len(k)-len(ext)]
-		notes := candidates[nonExt+firmwareNotesExtension]
-		if notes == "" {
+		notes := files[nonExt+firmwareNotesExtension]
+		if notes == "" && requireNotes {
 			log.Printf("ignoring candidate %q, missing release notes", k)
 			continue
 		}
+		checksum := files[k+firmwareChecksumExtension]
+		if checksum == "" {
+			checksum = files[nonExt+firmwareChecksumExtension]
+		}
 		f := &Firmware{
 			URL:             v,
 			ReleaseNotesURL: notes,
+			Source:          source,
+			ChecksumURL:     checksum,
 		}
 		if _, err := f.VersionName(); err != nil {
 			log.Printf("ignoring candidate %q, can't find version name: %v", k, err)
@@ -158,7 +244,26 @@ func Load() ([]*Firmware, error) {
 		}
 		firmwares = append(firmwares, f)
 	}
-	sort.Slice(firmwares, func(i, j int) bool {
+	sortFirmwares(firmwares)
+	return firmwares
+}
+
+// sortFirmwares sorts the firmwares with the newest version
+// first. Firmwares with the same version are sorted in reverse
+// chronological order.
+func sortFirmwares(firmwares []*Firmware) {
+	sort.SliceStable(firmwares, func(i, j int) bool {
+		v1, err := firmwares[i].Version()
+		if err != nil {
+			panic(err)
+		}
+		v2, err := firmwares[j].Version()
+		if err != nil {
+			panic(err)
+		}
+		if c := v1.Compare(v2); c != 0 {
+			return c > 0
+		}
 		d1, err := firmwares[i].Date()
 		if err != nil {
 			panic(err)
@@ -170,5 +275,4 @@ func Load() ([]*Firmware, error) {
 		// Reverse chronological order
 		return d2.Before(d1)
 	})
-	return firmwares, nil
 }
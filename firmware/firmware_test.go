@@ -40,3 +40,24 @@ func TestFirmware(t *testing.T) {
 	}
 	assert.Equal(t, date2, time.Date(2020, 06, 15, 0, 0, 0, 0, time.UTC))
 }
+
+func TestSortFirmwares(t *testing.T) {
+	names := []string{
+		"FrSkyOSD-v1.99.0_20200615.bin",
+		"FrSkyOSD-v2.0.0_20200701.bin",
+		"FrSkyOSD-v1.0.1_20200801.bin",
+		"FrSkyOSD-v1.99.1_20200620.bin",
+	}
+	var firmwares []*Firmware
+	for _, n := range names {
+		firmwares = append(firmwares, &Firmware{URL: "https://example.com/" + n})
+	}
+	sortFirmwares(firmwares)
+	var sorted []string
+	for _, f := range firmwares {
+		v, err := f.Version()
+		assert.NoError(t, err)
+		sorted = append(sorted, v.String())
+	}
+	assert.Equal(t, []string{"2.0.0", "2.0.0-beta.2", "2.0.0-beta.1", "1.0.1"}, sorted)
+}
@@ -0,0 +1,179 @@
+package firmware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"osdapp/internal/osdversion"
+)
+
+const (
+	// MaxImageSize is the maximum size of a firmware image
+	MaxImageSize = 1024 * 1024
+	// vectorTableEntries is the number of vector table entries
+	// checked, the ones defined by the Cortex-M core
+	vectorTableEntries = 16
+	minImageSize       = vectorTableEntries * 4
+)
+
+type memoryRegion struct {
+	Base uint32
+	Size uint32
+}
+
+func (r memoryRegion) contains(addr uint32) bool {
+	return addr >= r.Base && addr-r.Base < r.Size
+}
+
+var (
+	// Regions where flash might be mapped. The bounds are
+	// intentionally generous, to avoid rejecting valid
+	// images from future firmware versions.
+	flashRegions = []memoryRegion{
+		{Base: 0x00000000, Size: MaxImageSize},
+		{Base: 0x08000000, Size: MaxImageSize},
+	}
+	ramRegions = []memoryRegion{
+		{Base: 0x20000000, Size: 512 * 1024},
+	}
+
+	versionMarkerRegexp = regexp.MustCompile(`FrSky ?OSD[ _-]v?(\d+)\.(\d+)\.(\d+)`)
+)
+
+// ImageError is returned by ParseImage when the data doesn't
+// look like a valid firmware for the OSD.
+type ImageError struct {
+	Problems []string
+}
+
+func (e *ImageError) Error() string {
+	return "invalid firmware image: " + strings.Join(e.Problems, ", ")
+}
+
+// Image represents a firmware image that has passed validation
+type Image struct {
+	Data []byte
+	// InitialSP is the initial stack pointer from the vector table
+	InitialSP uint32
+	// ResetHandler is the address of the reset handler from the
+	// vector table
+	ResetHandler uint32
+	// Version is the version found in the image, nil if
+	// the image has no version marker
+	Version *osdversion.Version
+}
+
+// HasVersion returns true iff a version marker was found in
+// the image
+func (img *Image) HasVersion() bool {
+	return img.Version != nil
+}
+
+// VersionName returns the user visible version found in the
+// image, or an empty string if it has none.
+func (img *Image) VersionName() string {
+	if !img.HasVersion() {
+		return ""
+	}
+	return img.Version.String()
+}
+
+func inRegions(addr uint32, regions []memoryRegion) bool {
+	for _, r := range regions {
+		if r.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFlashAddr(addr uint32) bool {
+	return inRegions(addr, flashRegions)
+}
+
+// ParseImage checks that data is plausible as a firmware for the
+// OSD MCU and returns an *Image if it is. Otherwise, it returns
+// an *ImageError describing the problems.
+func ParseImage(data []byte) (*Image, error) {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if len(data) < minImageSize {
+		return nil, &ImageError{Problems: []string{
+			fmt.Sprintf("image has %d bytes, minimum is %d", len(data), minImageSize),
+		}}
+	}
+	switch {
+	case data[0] == ':':
+		addProblem("image looks like an Intel HEX file, not a binary")
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		addProblem("image looks like a zip file, not a binary")
+	}
+	if len(data) > MaxImageSize {
+		addProblem("image has %d bytes, maximum is %d", len(data), MaxImageSize)
+	}
+	img := &Image{
+		Data:         data,
+		InitialSP:    binary.LittleEndian.Uint32(data),
+		ResetHandler: binary.LittleEndian.Uint32(data[4:]),
+	}
+	if !inRegions(img.InitialSP, ramRegions) || img.InitialSP%4 != 0 {
+		addProblem("initial stack pointer 0x%08x is not in RAM", img.InitialSP)
+	}
+	if img.ResetHandler&1 == 0 || !isFlashAddr(img.ResetHandler) {
+		addProblem("reset handler 0x%08x is not a Thumb address in flash", img.ResetHandler)
+	}
+	// Exception handlers must be either unused or Thumb addresses in flash.
+	// Entries 7-10 and 13 are reserved and might contain anything.
+	for ii := 2; ii < vectorTableEntries; ii++ {
+		switch ii {
+		case 7, 8, 9, 10, 13:
+			continue
+		}
+		addr := binary.LittleEndian.Uint32(data[ii*4:])
+		if addr != 0 && (addr&1 == 0 || !isFlashAddr(addr)) {
+			addProblem("exception handler %d at 0x%08x is not a Thumb address in flash", ii, addr)
+		}
+	}
+	if m := versionMarkerRegexp.FindSubmatch(data); m != nil {
+		major, _ := strconv.Atoi(string(m[1]))
+		minor, _ := strconv.Atoi(string(m[2]))
+		patch, _ := strconv.Atoi(string(m[3]))
+		v := osdversion.New(major, minor, patch)
+		img.Version = &v
+	}
+	if len(problems) > 0 {
+		return nil, &ImageError{Problems: problems}
+	}
+	return img, nil
+}
+
+// Validate returns the error returned by ParseImage, if any.
+// It can be used as frskyosd.FlashOptions.Validate.
+func Validate(data []byte) error {
+	_, err := ParseImage(data)
+	return err
+}
+
+// CheckVersion returns an error if the image has a version marker
+// that doesn't match the version of the given firmware.
+func (img *Image) CheckVersion(f *Firmware) error {
+	if !img.HasVersion() {
+		return nil
+	}
+	v, err := f.Version()
+	if err != nil {
+		return nil
+	}
+	if v.Compare(*img.Version) != 0 {
+		return &ImageError{Problems: []string{
+			fmt.Sprintf("image contains version %s, expecting %s", img.Version, v),
+		}}
+	}
+	return nil
+}
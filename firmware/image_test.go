@@ -0,0 +1,81 @@
+package firmware
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage returns a minimal image with a valid vector table
+func testImage(size int) []byte {
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint32(data, 0x20020000)
+	binary.LittleEndian.PutUint32(data[4:], 0x08004321)
+	binary.LittleEndian.PutUint32(data[8:], 0x08004401)
+	binary.LittleEndian.PutUint32(data[12:], 0x08004403)
+	return data
+}
+
+func TestParseImage(t *testing.T) {
+	data := testImage(1024)
+	copy(data[512:], "FrSkyOSD v1.99.0")
+	img, err := ParseImage(data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0x20020000), img.InitialSP)
+		assert.Equal(t, uint32(0x08004321), img.ResetHandler)
+		assert.True(t, img.HasVersion())
+		assert.Equal(t, "2.0.0-beta.1", img.VersionName())
+
+		f := &Firmware{URL: "file:///FrSkyOSD-v1.99.0_20200615.bin"}
+		assert.NoError(t, img.CheckVersion(f))
+		f = &Firmware{URL: "file:///FrSkyOSD-v1.0.0_20191025.bin"}
+		assert.Error(t, img.CheckVersion(f))
+	}
+
+	img, err = ParseImage(testImage(1024))
+	if assert.NoError(t, err) {
+		assert.False(t, img.HasVersion())
+		assert.Equal(t, "", img.VersionName())
+	}
+}
+
+func TestParseImageInvalid(t *testing.T) {
+	testInvalid := func(name string, data []byte) {
+		_, err := ParseImage(data)
+		if assert.Error(t, err, name) {
+			assert.IsType(t, &ImageError{}, err, name)
+		}
+		assert.Equal(t, err, Validate(data), name)
+	}
+	testInvalid("empty", nil)
+	testInvalid("too short", testImage(32))
+	testInvalid("too long", testImage(MaxImageSize+1))
+	testInvalid("zeros", make([]byte, 1024))
+
+	data := testImage(1024)
+	binary.LittleEndian.PutUint32(data, 0x10000000)
+	testInvalid("bad stack pointer", data)
+
+	data = testImage(1024)
+	binary.LittleEndian.PutUint32(data[4:], 0x08004320)
+	testInvalid("non-thumb reset handler", data)
+
+	data = testImage(1024)
+	binary.LittleEndian.PutUint32(data[12:], 0x40000001)
+	testInvalid("bad exception handler", data)
+
+	hex := []byte(":020000040800F2\n:10000000000002200D4300080F4300080F430008B8\n")
+	for len(hex) < 1024 {
+		hex = append(hex, hex...)
+	}
+	testInvalid("intel hex", hex)
+}
+
+func TestMemoryRegionContains(t *testing.T) {
+	r := memoryRegion{Base: 0x08000000, Size: 0x1000}
+	assert.False(t, r.contains(0x07ffffff))
+	assert.True(t, r.contains(0x08000000))
+	assert.True(t, r.contains(0x08000fff))
+	assert.False(t, r.contains(0x08001000))
+}
@@ -0,0 +1,341 @@
+package firmware
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"osdapp/internal/osdversion"
+)
+
+const (
+	hexExtension = ".hex"
+	zipExtension = ".zip"
+
+	hexRecordData                   = 0x00
+	hexRecordEOF                    = 0x01
+	hexRecordExtendedSegmentAddress = 0x02
+	hexRecordStartSegmentAddress    = 0x03
+	hexRecordExtendedLinearAddress  = 0x04
+	hexRecordStartLinearAddress     = 0x05
+
+	// Value used to fill the gaps in Intel HEX files,
+	// matching erased flash.
+	hexFillByte = 0xFF
+
+	// AppBaseAddress is the flash address where the bootloader
+	// writes the firmware, right after the 16KiB it occupies.
+	// Images are flashed starting at this address.
+	AppBaseAddress = 0x08004000
+
+	// maxHexFileSize is the maximum size of an Intel HEX file.
+	// With the usual 16 byte records, each byte in the image
+	// takes about 2.8 bytes.
+	maxHexFileSize = 4 * MaxImageSize
+	// maxNotesSize is the maximum size of the release notes
+	maxNotesSize = 1024 * 1024
+)
+
+var (
+	// FileExtensions contains the extensions for all the
+	// supported firmware file formats
+	FileExtensions = []string{firmwareExtension, hexExtension, zipExtension}
+)
+
+// SpecError is returned by Resolve when the spec is neither
+// a firmware file nor a valid version.
+type SpecError struct {
+	Spec string
+	Err  error
+}
+
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("%q is neither a file nor a valid version: %v", e.Spec, e.Err)
+}
+
+// File represents a loaded firmware file
+type File struct {
+	// Name of the firmware image. For zip bundles, this is the
+	// name of the image inside the bundle.
+	Name string
+	// Data contains the raw image, ready to be flashed
+	Data []byte
+	// ReleaseNotes contains the release notes in Markdown format,
+	// if available (only for zip bundles).
+	ReleaseNotes string
+}
+
+// IsFirmwareFilename returns true iff the filename has an extension
+// for a supported firmware file format.
+func IsFirmwareFilename(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, v := range FileExtensions {
+		if ext == v {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFile loads the firmware file at the given path. See Decode.
+func LoadFile(filename string) (*File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(filepath.Base(filename), f)
+}
+
+// Resolve loads the firmware given by spec, which is either the path
+// to a firmware file or a version as accepted by Find. Versions are
+// looked up in the given sources and the cache, which is also used
+// for downloading them if non-nil. The returned *Firmware is nil
+// for files. Invalid versions return a *SpecError.
+func Resolve(ctx context.Context, spec string, sources []Source, cache *Cache, includeBeta bool) (*File, *Firmware, error) {
+	if _, err := os.Stat(spec); err == nil || strings.ContainsAny(spec, `/\`) || IsFirmwareFilename(spec) {
+		fw, err := LoadFile(spec)
+		return fw, nil, err
+	}
+	if spec != "latest" {
+		if _, err := osdversion.Parse(spec); err != nil {
+			return nil, nil, &SpecError{Spec: spec, Err: err}
+		}
+	}
+	if cache != nil {
+		sources = append(sources, cache)
+	}
+	firmwares, err := LoadFrom(ctx, sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := Find(firmwares, spec, includeBeta)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r io.ReadCloser
+	if cache != nil {
+		r, err = cache.Open(ctx, f)
+	} else {
+		r, err = f.Open(ctx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	name, err := f.Filename()
+	if err != nil {
+		return nil, nil, err
+	}
+	fw, err := Decode(name, r)
+	return fw, f, err
+}
+
+// Decode reads a firmware file in any of the supported formats, using
+// its name to determine the format. Files without a known extension are
+// identified by their contents. Raw images are returned as is.
+func Decode(name string, r io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if ext != firmwareExtension && ext != hexExtension && ext != zipExtension {
+		// Unknown extension, try to guess the format
+		switch {
+		case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+			ext = zipExtension
+		case len(data) > 0 && data[0] == ':':
+			ext = hexExtension
+		}
+	}
+	switch ext {
+	case zipExtension:
+		return decodeZip(data)
+	case hexExtension:
+		image, base, err := DecodeHex(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if base != AppBaseAddress {
+			return nil, fmt.Errorf("image starts at 0x%08x instead of 0x%08x, it might include the bootloader or be linked for another target", base, AppBaseAddress)
+		}
+		return &File{Name: name, Data: image}, nil
+	}
+	return &File{Name: name, Data: data}, nil
+}
+
+// DecodeHex decodes an Intel HEX file into a contiguous image,
+// starting at the lowest address in the file. Gaps are filled with
+// 0xFF. It returns the image and its base address.
+func DecodeHex(r io.Reader) ([]byte, uint32, error) {
+	type segment struct {
+		addr uint32
+		data []byte
+	}
+	var segments []segment
+	var upper uint32
+	var minAddr, maxAddr uint32
+	seenEOF := false
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if seenEOF {
+			return nil, 0, fmt.Errorf("line %d: data after EOF record", lineNo)
+		}
+		if line[0] != ':' {
+			return nil, 0, fmt.Errorf("line %d: missing start code", lineNo)
+		}
+		rec, err := hex.DecodeString(line[1:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, 0, fmt.Errorf("line %d: invalid record length", lineNo)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, 0, fmt.Errorf("line %d: invalid checksum", lineNo)
+		}
+		offset := uint32(rec[1])<<8 | uint32(rec[2])
+		payload := rec[4 : len(rec)-1]
+		switch rec[3] {
+		case hexRecordData:
+			addr := upper + offset
+			end := addr + uint32(len(payload))
+			if len(segments) == 0 || addr < minAddr {
+				minAddr = addr
+			}
+			if len(segments) == 0 || end > maxAddr {
+				maxAddr = end
+			}
+			segments = append(segments, segment{addr: addr, data: payload})
+		case hexRecordEOF:
+			seenEOF = true
+		case hexRecordExtendedSegmentAddress:
+			if len(payload) != 2 {
+				return nil, 0, fmt.Errorf("line %d: invalid extended segment address", lineNo)
+			}
+			upper = (uint32(payload[0])<<8 | uint32(payload[1])) << 4
+		case hexRecordExtendedLinearAddress:
+			if len(payload) != 2 {
+				return nil, 0, fmt.Errorf("line %d: invalid extended linear address", lineNo)
+			}
+			upper = (uint32(payload[0])<<8 | uint32(payload[1])) << 16
+		case hexRecordStartSegmentAddress, hexRecordStartLinearAddress:
+			// Entry point, not needed for flashing
+		default:
+			return nil, 0, fmt.Errorf("line %d: unknown record type %d", lineNo, rec[3])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, 0, err
+	}
+	if !seenEOF {
+		return nil, 0, errors.New("missing EOF record, file might be truncated")
+	}
+	if len(segments) == 0 {
+		return nil, 0, errors.New("no data records found")
+	}
+	if maxAddr-minAddr > MaxImageSize {
+		return nil, 0, fmt.Errorf("image spans %d bytes, maximum is %d", maxAddr-minAddr, MaxImageSize)
+	}
+	image := bytes.Repeat([]byte{hexFillByte}, int(maxAddr-minAddr))
+	for _, seg := range segments {
+		copy(image[seg.addr-minAddr:], seg.data)
+	}
+	return image, minAddr, nil
+}
+
+// decodeZip loads a release bundle, which must contain exactly one
+// firmware image and, optionally, its release notes.
+func decodeZip(data []byte) (*File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var image *zip.File
+	notes := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case firmwareExtension, hexExtension:
+			if image != nil {
+				return nil, fmt.Errorf("bundle contains multiple firmware images: %s and %s", image.Name, f.Name)
+			}
+			image = f
+		case firmwareNotesExtension:
+			notes[strings.TrimSuffix(name, path.Ext(name))] = f
+		}
+	}
+	if image == nil {
+		return nil, errors.New("bundle doesn't contain any firmware image")
+	}
+	limit := int64(MaxImageSize)
+	if strings.ToLower(path.Ext(image.Name)) == hexExtension {
+		limit = maxHexFileSize
+	}
+	imageData, err := readZipFile(image, limit)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(image.Name)
+	fw, err := Decode(name, bytes.NewReader(imageData))
+	if err != nil {
+		return nil, err
+	}
+	nonExt := strings.TrimSuffix(name, path.Ext(name))
+	notesFile := notes[nonExt]
+	if notesFile == nil && len(notes) == 1 {
+		for _, v := range notes {
+			notesFile = v
+		}
+	}
+	if notesFile != nil {
+		notesData, err := readZipFile(notesFile, maxNotesSize)
+		if err != nil {
+			return nil, err
+		}
+		fw.ReleaseNotes = string(notesData)
+	}
+	return fw, nil
+}
+
+// readZipFile reads the file from a zip, failing if it has more
+// than limit bytes
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is too large, maximum is %d bytes", f.Name, limit)
+	}
+	return data, nil
+}
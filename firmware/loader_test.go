@@ -0,0 +1,184 @@
+package firmware
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeHex returns an Intel HEX representation of data at the
+// given base address, using 16 byte data records.
+func encodeHex(data []byte, base uint32) string {
+	var sb strings.Builder
+	record := func(typ byte, offset uint16, payload []byte) {
+		rec := []byte{byte(len(payload)), byte(offset >> 8), byte(offset), typ}
+		rec = append(rec, payload...)
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		rec = append(rec, -sum)
+		fmt.Fprintf(&sb, ":%X\n", rec)
+	}
+	upper := uint32(0xFFFFFFFF)
+	for ii := 0; ii < len(data); ii += 16 {
+		addr := base + uint32(ii)
+		if addr>>16 != upper {
+			upper = addr >> 16
+			record(hexRecordExtendedLinearAddress, 0, []byte{byte(upper >> 8), byte(upper)})
+		}
+		end := ii + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		record(hexRecordData, uint16(addr), data[ii:end])
+	}
+	record(hexRecordStartLinearAddress, 0, []byte{0x08, 0x00, 0x43, 0x21})
+	record(hexRecordEOF, 0, nil)
+	return sb.String()
+}
+
+func TestDecodeHex(t *testing.T) {
+	data := testImage(100)
+	copy(data[64:], "payload")
+	text := encodeHex(data, AppBaseAddress)
+
+	fw, err := Decode("FrSkyOSD-v2.0.0_20200701.hex", strings.NewReader(text))
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, fw.Data)
+		_, err := ParseImage(fw.Data)
+		assert.NoError(t, err)
+	}
+
+	// Images crossing a 64KiB boundary need several extended
+	// linear address records
+	image, base, err := DecodeHex(strings.NewReader(encodeHex(data, 0x0800FFF0)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0x0800FFF0), base)
+		assert.Equal(t, data, image)
+	}
+
+	// Images including the bootloader or linked at another
+	// address must be rejected
+	for _, base := range []uint32{0x08000000, AppBaseAddress + 0x100} {
+		_, err = Decode("FrSkyOSD-v2.0.0_20200701.hex", strings.NewReader(encodeHex(data, base)))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), fmt.Sprintf("0x%08x", base))
+		}
+	}
+
+	// Unknown extension, detected by contents
+	fw, err = Decode("firmware", strings.NewReader(text))
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, fw.Data)
+	}
+
+	// Gaps must be filled with 0xFF
+	gapped := strings.Replace(encodeHex(data[:16], 0x08000000), ":00000001FF\n", "", 1) +
+		encodeHex(data[32:48], 0x08000020)
+	image, base, err = DecodeHex(strings.NewReader(gapped))
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0x08000000), base)
+		assert.Len(t, image, 48)
+		assert.Equal(t, bytes.Repeat([]byte{0xFF}, 16), image[16:32])
+		assert.Equal(t, data[32:48], image[32:48])
+	}
+}
+
+func TestDecodeHexInvalid(t *testing.T) {
+	text := encodeHex(testImage(64), 0x08000000)
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+
+	_, _, err := DecodeHex(strings.NewReader(strings.Join(lines[:len(lines)-1], "\n")))
+	assert.Error(t, err, "truncated")
+
+	corrupted := strings.Replace(text, lines[1], lines[1][:len(lines[1])-2]+"00", 1)
+	_, _, err = DecodeHex(strings.NewReader(corrupted))
+	assert.Error(t, err, "bad checksum")
+
+	_, _, err = DecodeHex(strings.NewReader("not hex\n"))
+	assert.Error(t, err, "no start code")
+}
+
+func testZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeZip(t *testing.T) {
+	image := testImage(128)
+	data := testZip(t, map[string]string{
+		"release/FrSkyOSD-v2.0.0_20200701.bin": string(image),
+		"release/FrSkyOSD-v2.0.0_20200701.md":  "# Changes",
+		"release/README.txt":                   "ignored",
+	})
+	fw, err := Decode("FrSkyOSD-v2.0.0_20200701.zip", bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "FrSkyOSD-v2.0.0_20200701.bin", fw.Name)
+		assert.Equal(t, image, fw.Data)
+		assert.Equal(t, "# Changes", fw.ReleaseNotes)
+	}
+
+	data = testZip(t, map[string]string{
+		"FrSkyOSD-v2.0.0_20200701.hex": encodeHex(image, AppBaseAddress),
+	})
+	fw, err = Decode("bundle.zip", bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, image, fw.Data)
+		assert.Equal(t, "", fw.ReleaseNotes)
+	}
+
+	// HEX files are much larger than the image they contain
+	large := testImage(MaxImageSize / 2)
+	data = testZip(t, map[string]string{
+		"FrSkyOSD-v2.0.0_20200701.hex": encodeHex(large, AppBaseAddress),
+	})
+	fw, err = Decode("bundle.zip", bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, large, fw.Data)
+	}
+
+	data = testZip(t, map[string]string{
+		"FrSkyOSD-v2.0.0_20200701.bin": string(testImage(MaxImageSize + 1)),
+	})
+	_, err = Decode("bundle.zip", bytes.NewReader(data))
+	assert.Error(t, err, "too large")
+
+	data = testZip(t, map[string]string{
+		"a.bin": string(image),
+		"b.bin": string(image),
+	})
+	_, err = Decode("bundle.zip", bytes.NewReader(data))
+	assert.Error(t, err, "multiple images")
+
+	data = testZip(t, map[string]string{"notes.md": "notes"})
+	_, err = Decode("bundle.zip", bytes.NewReader(data))
+	assert.Error(t, err, "no images")
+}
+
+func TestFirmwareExtensions(t *testing.T) {
+	for _, ext := range FileExtensions {
+		f := &Firmware{URL: "https://example.com/FrSkyOSD-v2.0.0_20200701" + ext}
+		vers, err := f.VersionName()
+		assert.NoError(t, err)
+		assert.Equal(t, "2.0.0", vers)
+	}
+	f := &Firmware{URL: "https://example.com/FrSkyOSD-v2.0.0_20200701.elf"}
+	_, err := f.VersionName()
+	assert.Error(t, err)
+}
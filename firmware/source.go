@@ -0,0 +1,259 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v30/github"
+
+	"osdapp/internal/httpclient"
+)
+
+const (
+	// DefaultSourceURL is the URL for the official firmwares
+	DefaultSourceURL = "https://github.com/FrSkyRC/PixelOSD/firmware"
+
+	maxIndexSize = 4 << 20
+)
+
+var (
+	hrefRegexp = regexp.MustCompile(`(?i)href\s*=\s*["']?([^"' >]+)`)
+)
+
+// Source is an interface that provides the available firmwares.
+// Use NewSource to create a Source from the builtin ones or
+// provide your own.
+type Source interface {
+	// Name returns an user visible name for the source
+	Name() string
+	// Firmwares returns the firmwares available in the source
+	Firmwares(ctx context.Context) ([]*Firmware, error)
+}
+
+var (
+	_ Source = (*GitHubSource)(nil)
+	_ Source = (*HTTPIndexSource)(nil)
+	_ Source = (*DirSource)(nil)
+)
+
+// GitHubSource retrieves firmwares from a directory in a GitHub
+// repository. Each firmware must be accompanied by its release
+// notes.
+type GitHubSource struct {
+	// URL of the directory, in the form
+	// https://github.com/owner/repo/path/to/dir
+	URL string
+}
+
+// Name implements the Source interface
+func (s *GitHubSource) Name() string {
+	return s.URL
+}
+
+// Firmwares implements the Source interface
+func (s *GitHubSource) Firmwares(ctx context.Context) ([]*Firmware, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() != "github.com" {
+		return nil, fmt.Errorf("host is %q instead of github.com", u.Hostname())
+	}
+	parts := strings.Split(u.Path[1:], "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%q is not a GitHub repository URL", s.URL)
+	}
+	repoPath := strings.Join(parts[2:], "/")
+	c := httpclient.GitHub()
+	_, dirContents, _, err := c.Repositories.GetContents(ctx, parts[0], parts[1], repoPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	blobs := make(map[string]*github.RepositoryContent)
+	for _, entry := range dirContents {
+		filename := entry.GetName()
+		ext := strings.ToLower(filepath.Ext(filename))
+		switch ext {
+		case firmwareExtension, hexExtension, zipExtension:
+			files[filename] = entry.GetDownloadURL()
+			blobs[entry.GetDownloadURL()] = entry
+		case firmwareNotesExtension, firmwareChecksumExtension:
+			files[filename] = entry.GetDownloadURL()
+		}
+	}
+	firmwares := firmwaresFromFiles(files, s.Name(), true)
+	for _, f := range firmwares {
+		if entry := blobs[f.URL]; entry != nil {
+			f.Size = int64(entry.GetSize())
+			f.GitBlobSHA = entry.GetSHA()
+		}
+	}
+	return firmwares, nil
+}
+
+// HTTPIndexSource retrieves firmwares from an HTTP(S) index page,
+// like the ones generated by most web servers for directory
+// listings. Every link to a firmware file in the page is
+// considered.
+type HTTPIndexSource struct {
+	URL string
+}
+
+// Name implements the Source interface
+func (s *HTTPIndexSource) Name() string {
+	return s.URL
+}
+
+// Firmwares implements the Source interface
+func (s *HTTPIndexSource) Firmwares(ctx context.Context) ([]*Firmware, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpclient.Default().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("invalid HTTP response code %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIndexSize))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, m := range hrefRegexp.FindAllStringSubmatch(string(data), -1) {
+		ref, err := url.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		u := base.ResolveReference(ref)
+		filename := path.Base(u.Path)
+		switch strings.ToLower(path.Ext(filename)) {
+		case firmwareExtension, hexExtension, zipExtension, firmwareNotesExtension, firmwareChecksumExtension:
+			files[filename] = u.String()
+		}
+	}
+	return firmwaresFromFiles(files, s.Name(), false), nil
+}
+
+// DirSource retrieves firmwares from a local directory, like
+// a mounted USB drive.
+type DirSource struct {
+	Dir string
+}
+
+// Name implements the Source interface
+func (s *DirSource) Name() string {
+	return s.Dir
+}
+
+// Firmwares implements the Source interface
+func (s *DirSource) Firmwares(ctx context.Context) ([]*Firmware, error) {
+	entries, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		filename := entry.Name()
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case firmwareExtension, hexExtension, zipExtension, firmwareNotesExtension, firmwareChecksumExtension:
+			files[filename] = fileURL(filepath.Join(s.Dir, filename))
+		}
+	}
+	return firmwaresFromFiles(files, s.Name(), false), nil
+}
+
+// fileURL returns a file:// URL for the given local path
+func fileURL(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		// Windows paths, e.g. C:/foo
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Path: p}
+	return u.String()
+}
+
+// urlFilePath returns the local path for the given file:// URL
+func urlFilePath(u *url.URL) string {
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Windows paths, e.g. /C:/foo
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// NewSource returns a Source from the given origin. GitHub URLs
+// create a GitHubSource, other HTTP(S) URLs create an HTTPIndexSource
+// while file:// URLs and local paths create a DirSource.
+func NewSource(origin string) (Source, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == "" {
+		return nil, fmt.Errorf("empty firmware source")
+	}
+	if u, err := url.Parse(origin); err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			if u.Hostname() == "github.com" {
+				return &GitHubSource{URL: origin}, nil
+			}
+			return &HTTPIndexSource{URL: origin}, nil
+		case "file":
+			return &DirSource{Dir: urlFilePath(u)}, nil
+		}
+	}
+	if filepath.IsAbs(origin) {
+		return &DirSource{Dir: origin}, nil
+	}
+	if _, err := os.Stat(origin); err == nil {
+		return &DirSource{Dir: origin}, nil
+	}
+	return nil, fmt.Errorf("could not create a firmware Source from %q", origin)
+}
+
+// ParseSources parses a list of sources separated by newlines
+// or commas. Empty lines and lines starting with # are ignored.
+func ParseSources(spec string) ([]Source, error) {
+	var sources []Source
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		src, err := NewSource(line)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// DefaultSources returns the sources used by Load
+func DefaultSources() []Source {
+	return []Source{&GitHubSource{URL: DefaultSourceURL}}
+}
@@ -0,0 +1,134 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFiles(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firmware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir,
+		"FrSkyOSD-v1.0.0_20191025.bin",
+		"FrSkyOSD-v1.99.0_20200615.bin",
+		"FrSkyOSD-v1.99.0_20200615.md",
+		"README.txt",
+		"invalid.bin",
+	)
+	src := &DirSource{Dir: dir}
+	firmwares, err := src.Firmwares(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmwares, 2) {
+		vers, _ := firmwares[0].VersionName()
+		assert.Equal(t, "2.0.0-beta.1", vers)
+		assert.NotEmpty(t, firmwares[0].ReleaseNotesURL)
+		assert.Equal(t, dir, firmwares[0].Source)
+		vers, _ = firmwares[1].VersionName()
+		assert.Equal(t, "1.0.0", vers)
+		assert.Empty(t, firmwares[1].ReleaseNotesURL)
+
+		r, err := firmwares[1].Open(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "FrSkyOSD-v1.0.0_20191025.bin", string(data))
+	}
+}
+
+func TestHTTPIndexSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>
+<a href="FrSkyOSD-v1.0.0_20191025.bin">1.0.0</a>
+<a href='/other/FrSkyOSD-v1.1.0_20200101.bin'>1.1.0</a>
+<a href="FrSkyOSD-v1.1.0_20200101.md">notes</a>
+<a href="../">Parent</a>
+</body></html>`)
+	}))
+	defer srv.Close()
+	src := &HTTPIndexSource{URL: srv.URL + "/firmware/"}
+	firmwares, err := src.Firmwares(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmwares, 2) {
+		assert.Equal(t, srv.URL+"/other/FrSkyOSD-v1.1.0_20200101.bin", firmwares[0].URL)
+		assert.Equal(t, srv.URL+"/firmware/FrSkyOSD-v1.1.0_20200101.md", firmwares[0].ReleaseNotesURL)
+		assert.Equal(t, srv.URL+"/firmware/FrSkyOSD-v1.0.0_20191025.bin", firmwares[1].URL)
+	}
+}
+
+func TestLoadFrom(t *testing.T) {
+	dir1, err := ioutil.TempDir("", "firmware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "firmware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir2)
+	writeTestFiles(t, dir1, "FrSkyOSD-v1.0.0_20191025.bin")
+	writeTestFiles(t, dir2, "FrSkyOSD-v1.0.0_20191025.bin", "FrSkyOSD-v1.1.0_20200101.bin")
+
+	missing := &DirSource{Dir: filepath.Join(dir1, "missing")}
+	firmwares, err := LoadFrom(context.Background(), []Source{
+		&DirSource{Dir: dir1},
+		missing,
+		&DirSource{Dir: dir2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmwares, 2) {
+		assert.Equal(t, dir2, firmwares[0].Source)
+		assert.Equal(t, dir1, firmwares[1].Source)
+	}
+
+	_, err = LoadFrom(context.Background(), []Source{missing})
+	assert.Error(t, err)
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := ParseSources(`
+# Official firmwares
+https://github.com/FrSkyRC/PixelOSD/firmware
+https://example.com/firmware/, file:///media/usb/firmware
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, sources, 3) {
+		assert.IsType(t, &GitHubSource{}, sources[0])
+		assert.IsType(t, &HTTPIndexSource{}, sources[1])
+		if assert.IsType(t, &DirSource{}, sources[2]) {
+			assert.Equal(t, filepath.FromSlash("/media/usb/firmware"), sources[2].(*DirSource).Dir)
+		}
+	}
+	_, err = ParseSources("not-a-source")
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package firmware
+
+import (
+	"errors"
+	"fmt"
+
+	"osdapp/internal/osdversion"
+)
+
+// Newest returns the firmware with the highest version, or nil if
+// there are none. Beta firmwares are only considered if includeBeta
+// is true.
+func Newest(firmwares []*Firmware, includeBeta bool) *Firmware {
+	var newest *Firmware
+	var newestVersion osdversion.Version
+	for _, f := range firmwares {
+		v, err := f.Version()
+		if err != nil {
+			continue
+		}
+		if v.IsBeta() && !includeBeta {
+			continue
+		}
+		if newest == nil || newestVersion.Less(v) {
+			newest = f
+			newestVersion = v
+		}
+	}
+	return newest
+}
+
+// UpdateFor returns the newest firmware that's an upgrade from the
+// installed version, or nil if there's none. See Newest for the
+// meaning of includeBeta.
+func UpdateFor(installed osdversion.Version, firmwares []*Firmware, includeBeta bool) *Firmware {
+	newest := Newest(firmwares, includeBeta)
+	if newest == nil {
+		return nil
+	}
+	if v, _ := newest.Version(); !installed.Less(v) {
+		return nil
+	}
+	return newest
+}
+
+// Find returns the firmware with the given user visible version
+// (e.g. "2.0.1" or "3.0.0-beta.1"). If version is "latest", the
+// newest one is returned, as in Newest.
+func Find(firmwares []*Firmware, version string, includeBeta bool) (*Firmware, error) {
+	if version == "latest" {
+		if f := Newest(firmwares, includeBeta); f != nil {
+			return f, nil
+		}
+		return nil, errors.New("no firmwares found")
+	}
+	v, err := osdversion.Parse(version)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range firmwares {
+		if fv, err := f.Version(); err == nil && fv.Compare(v) == 0 {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("firmware %s not found", v)
+}
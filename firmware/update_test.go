@@ -0,0 +1,76 @@
+package firmware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"osdapp/internal/osdversion"
+)
+
+func TestUpdateFor(t *testing.T) {
+	var firmwares []*Firmware
+	for _, n := range []string{
+		"FrSkyOSD-v1.0.0_20191025.bin",
+		"FrSkyOSD-v2.0.0_20200701.bin",
+		"FrSkyOSD-v2.99.0_20200801.bin",
+	} {
+		firmwares = append(firmwares, &Firmware{URL: "https://example.com/" + n})
+	}
+	versionName := func(f *Firmware) string {
+		if f == nil {
+			return ""
+		}
+		name, err := f.VersionName()
+		assert.NoError(t, err)
+		return name
+	}
+
+	assert.Equal(t, "2.0.0", versionName(Newest(firmwares, false)))
+	assert.Equal(t, "3.0.0-beta.1", versionName(Newest(firmwares, true)))
+	assert.Nil(t, Newest(nil, true))
+
+	v1 := osdversion.MustParse("1.0.0")
+	v2 := osdversion.MustParse("2.0.0")
+	v3beta := osdversion.MustParse("3.0.0-beta.1")
+	assert.Equal(t, "2.0.0", versionName(UpdateFor(v1, firmwares, false)))
+	assert.Equal(t, "3.0.0-beta.1", versionName(UpdateFor(v1, firmwares, true)))
+	assert.Nil(t, UpdateFor(v2, firmwares, false))
+	assert.Equal(t, "3.0.0-beta.1", versionName(UpdateFor(v2, firmwares, true)))
+	assert.Nil(t, UpdateFor(v3beta, firmwares, true))
+	assert.Nil(t, UpdateFor(v3beta, firmwares, false))
+}
+
+func TestFind(t *testing.T) {
+	var firmwares []*Firmware
+	for _, n := range []string{
+		"FrSkyOSD-v2.0.0_20200701.bin",
+		"FrSkyOSD-v2.0.1_20200715.bin",
+		"FrSkyOSD-v2.99.0_20200801.bin",
+	} {
+		firmwares = append(firmwares, &Firmware{URL: "https://example.com/" + n})
+	}
+	for _, c := range []struct {
+		version     string
+		includeBeta bool
+		expected    string
+	}{
+		{"latest", false, "2.0.1"},
+		{"latest", true, "3.0.0-beta.1"},
+		{"2.0.0", false, "2.0.0"},
+		{"v2.0.1", false, "2.0.1"},
+		{"3.0.0-beta.1", false, "3.0.0-beta.1"},
+	} {
+		f, err := Find(firmwares, c.version, c.includeBeta)
+		if assert.NoError(t, err, c.version) {
+			name, _ := f.VersionName()
+			assert.Equal(t, c.expected, name, c.version)
+		}
+	}
+	_, err := Find(firmwares, "1.0.0", true)
+	assert.Error(t, err)
+	_, err = Find(firmwares, "invalid", true)
+	assert.Error(t, err)
+	_, err = Find(nil, "latest", true)
+	assert.Error(t, err)
+}
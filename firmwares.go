@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/canvas"
@@ -9,9 +11,8 @@ import (
 	"fyne.io/fyne/theme"
 	"fyne.io/fyne/widget"
 
-	"github.com/pkg/browser"
-
 	"osdapp/firmware"
+	"osdapp/internal/osdversion"
 )
 
 const (
@@ -27,9 +28,13 @@ type firmwaresDialog struct {
 	content            *fyne.Container
 	OnFirmwareSelected func(f *firmware.Firmware)
 	OnSelectFile       func()
+	OnReleaseNotes     func(f *firmware.Firmware)
 }
 
-func newFirmwaresDialog(firmwares []*firmware.Firmware, parent fyne.Window) *firmwaresDialog {
+// newFirmwaresDialog returns a dialog for selecting one of the given
+// firmwares. If installed is non-nil, each firmware is labeled as an
+// upgrade or downgrade relative to it.
+func newFirmwaresDialog(firmwares []*firmware.Firmware, installed *osdversion.Version, parent fyne.Window) *firmwaresDialog {
 	d := &firmwaresDialog{}
 	d.bg = canvas.NewRectangle(theme.BackgroundColor())
 	d.bg.FillColor = theme.BackgroundColor()
@@ -41,10 +46,20 @@ func newFirmwaresDialog(firmwares []*firmware.Firmware, parent fyne.Window) *fir
 	for _, f := range firmwares {
 		f := f
 		var name string
-		if vers, err := f.VersionName(); err == nil {
+		if vers, err := f.Version(); err == nil {
 			if date, err := f.Date(); err == nil {
 				name = fmt.Sprintf("%s (%s)", vers, date.Format("02 Jan 2006"))
 			}
+			if installed != nil {
+				switch vers.Compare(*installed) {
+				case 0:
+					name += " - installed"
+				case 1:
+					name += " - upgrade"
+				case -1:
+					name += " - downgrade"
+				}
+			}
 		}
 		if name == "" {
 			if n, err := f.Filename(); err == nil {
@@ -53,13 +68,19 @@ func newFirmwaresDialog(firmwares []*firmware.Firmware, parent fyne.Window) *fir
 				name = f.URL
 			}
 		}
+		if f.Source != firmware.DefaultSourceURL {
+			name = fmt.Sprintf("%s [%s]", name, path.Base(filepath.ToSlash(f.Source)))
+		}
 		selectFirmware := widget.NewButton(name, func() {
 			d.OnFirmwareSelected(f)
 		})
 		selectEntries = append(selectEntries, selectFirmware)
 		info := widget.NewButtonWithIcon("", theme.InfoIcon(), func() {
-			browser.OpenURL(f.ReleaseNotesURL)
+			d.OnReleaseNotes(f)
 		})
+		if f.ReleaseNotesURL == "" {
+			info.Disable()
+		}
 		infoEntries = append(infoEntries, info)
 	}
 	d.firmwares = widget.NewHBox(widget.NewVBox(selectEntries...), widget.NewVBox(infoEntries...))
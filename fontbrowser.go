@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/canvas"
+	"fyne.io/fyne/layout"
+	"fyne.io/fyne/widget"
+
+	"github.com/fiam/max7456tool/mcm"
+
+	"osdapp/fonts"
+)
+
+const (
+	fontPreviewScale = 4
+)
+
+// fontBrowser displays the font characters in a grid, allowing
+// the user to search them by symbol name and to preview them
+// zoomed in.
+type fontBrowser struct {
+	icons         []*FontIcon
+	grid          fyne.CanvasObject
+	symbols       *fonts.SymbolMap
+	symbolsSelect *widget.Select
+	search        *widget.Entry
+	matches       *widget.Label
+	preview       *canvas.Image
+	previewName   *widget.Label
+	selected      *FontIcon
+	hovered       *FontIcon
+	controls      fyne.CanvasObject
+}
+
+func newFontBrowser(charCount int, rowSize int) *fontBrowser {
+	b := &fontBrowser{}
+	var row []fyne.CanvasObject
+	var rows []fyne.CanvasObject
+	for ii := 0; ii < charCount; ii++ {
+		fi := NewFontIcon(ii)
+		fi.OnTapped = b.iconTapped
+		fi.OnHovered = b.iconHovered
+		row = append(row, fi)
+		b.icons = append(b.icons, fi)
+		if len(row) == rowSize || ii == charCount-1 {
+			rows = append(rows, widget.NewHBox(row...))
+			row = nil
+		}
+	}
+	b.grid = widget.NewVBox(rows...)
+	var symbolMapNames []string
+	for _, m := range fonts.SymbolMaps() {
+		symbolMapNames = append(symbolMapNames, m.Name)
+	}
+	b.symbolsSelect = widget.NewSelect(symbolMapNames, b.symbolMapChanged)
+	b.search = widget.NewEntry()
+	b.search.SetPlaceHolder("Search symbols")
+	b.search.OnChanged = b.searchChanged
+	b.matches = widget.NewLabel("")
+	b.preview = &canvas.Image{FillMode: canvas.ImageFillOriginal}
+	b.preview.SetMinSize(fyne.NewSize(mcm.CharWidth*fontPreviewScale, mcm.CharHeight*fontPreviewScale))
+	b.previewName = widget.NewLabel("")
+	b.controls = widget.NewHBox(
+		widget.NewVBox(
+			widget.NewHBox(widget.NewLabel("Symbols:"), b.symbolsSelect),
+			widget.NewHBox(b.search, b.matches),
+		),
+		layout.NewSpacer(),
+		b.previewName,
+		b.preview,
+	)
+	b.symbolsSelect.SetSelected(symbolMapNames[0])
+	return b
+}
+
+// Grid returns the canvas object with the characters
+func (b *fontBrowser) Grid() fyne.CanvasObject {
+	return b.grid
+}
+
+// Controls returns the canvas object with the symbol
+// search and the preview pane.
+func (b *fontBrowser) Controls() fyne.CanvasObject {
+	return b.controls
+}
+
+// Icons returns the icons for all the characters
+func (b *fontBrowser) Icons() []*FontIcon {
+	return b.icons
+}
+
+// SetSymbolMap changes the symbol map used to name the
+// characters if there's one with the given name.
+func (b *fontBrowser) SetSymbolMap(name string) {
+	if _, err := fonts.SymbolMapNamed(name); err == nil {
+		b.symbolsSelect.SetSelected(name)
+	}
+}
+
+// Refresh updates the preview pane after the font
+// data has changed.
+func (b *fontBrowser) Refresh() {
+	b.updatePreview()
+}
+
+func (b *fontBrowser) symbolMapChanged(name string) {
+	symbols, err := fonts.SymbolMapNamed(name)
+	if err != nil {
+		return
+	}
+	b.symbols = symbols
+	b.searchChanged(b.search.Text)
+	b.updatePreview()
+}
+
+func (b *fontBrowser) searchChanged(query string) {
+	highlighted := make(map[int]bool)
+	if b.symbols != nil {
+		for _, s := range b.symbols.Search(query) {
+			highlighted[s.Index] = true
+		}
+	}
+	for _, fi := range b.icons {
+		fi.SetHighlighted(highlighted[fi.Index])
+	}
+	if query == "" {
+		b.matches.SetText("")
+	} else {
+		b.matches.SetText(fmt.Sprintf("%d found", len(highlighted)))
+	}
+}
+
+func (b *fontBrowser) iconTapped(fi *FontIcon) {
+	b.selected = fi
+	b.updatePreview()
+}
+
+func (b *fontBrowser) iconHovered(fi *FontIcon, hovered bool) {
+	if hovered {
+		b.hovered = fi
+	} else if b.hovered == fi {
+		b.hovered = nil
+	}
+	b.updatePreview()
+}
+
+func (b *fontBrowser) symbolName(idx int) string {
+	if b.symbols != nil {
+		if s := b.symbols.Symbol(idx); s != nil {
+			return s.String()
+		}
+	}
+	return fmt.Sprintf("Char %d", idx)
+}
+
+func (b *fontBrowser) updatePreview() {
+	fi := b.hovered
+	if fi == nil {
+		fi = b.selected
+	}
+	if fi == nil {
+		b.previewName.SetText("")
+		b.preview.Image = fontCharImage(nil, fontIconBackground, fontPreviewScale)
+	} else {
+		b.previewName.SetText(b.symbolName(fi.Index))
+		b.preview.Image = fontCharImage(fi.FontData(), fontIconBackground, fontPreviewScale)
+	}
+	canvas.Refresh(b.preview)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/layout"
+	"fyne.io/fyne/theme"
+	"fyne.io/fyne/widget"
+
+	dlgs "github.com/sqweek/dialog"
+
+	"osdapp/fonts"
+	"osdapp/internal/dialog"
+)
+
+const (
+	customFontsOrigin = "Custom"
+)
+
+type fontComposeOverride struct {
+	font        *widget.Select
+	logo        *widget.Select
+	imagePath   string
+	first       *widget.Entry
+	count       *widget.Entry
+	sourceFirst *widget.Entry
+	row         *widget.Box
+}
+
+type fontComposeDialog struct {
+	app          *App
+	fonts        []*cachedFont
+	base         *widget.Select
+	overrides    []*fontComposeOverride
+	overridesBox *widget.Box
+	name         *widget.Entry
+	uploadButton *widget.Button
+	dlg          dialog.Dialog
+}
+
+func newFontComposeDialog(a *App) *fontComposeDialog {
+	d := &fontComposeDialog{app: a, fonts: a.cachedFonts()}
+	d.base = widget.NewSelect(d.fontNames(), nil)
+	d.overridesBox = widget.NewVBox()
+	d.name = widget.NewEntry()
+	d.name.SetPlaceHolder("Font name")
+	addFont := widget.NewButtonWithIcon("Add Font Range", theme.ContentAddIcon(), d.addFontOverride)
+	addImage := widget.NewButtonWithIcon("Add Image", theme.ContentAddIcon(), d.addImageOverride)
+	addLogo := widget.NewButtonWithIcon("Add Logo", theme.ContentAddIcon(), d.addLogoOverride)
+	saveButton := widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), d.save)
+	d.uploadButton = widget.NewButtonWithIcon("Upload", theme.MailSendIcon(), d.upload)
+	if a.caps == nil || !a.caps.Fonts {
+		d.uploadButton.Disable()
+	}
+	content := widget.NewVBox(
+		widget.NewHBox(widget.NewLabel("Base Font:"), d.base),
+		widget.NewLabel("Overrides:"),
+		d.overridesBox,
+		widget.NewHBox(addFont, addImage, addLogo, layout.NewSpacer()),
+		widget.NewHBox(widget.NewLabel("Name:"), d.name, layout.NewSpacer(), saveButton, d.uploadButton),
+	)
+	d.dlg = dialog.ShowCustom("Compose Font", "Close", content, a.window)
+	return d
+}
+
+func (d *fontComposeDialog) fontNames() []string {
+	names := make([]string, len(d.fonts))
+	for ii, f := range d.fonts {
+		names[ii] = f.String()
+	}
+	return names
+}
+
+func (d *fontComposeDialog) findFont(name string) *cachedFont {
+	for _, f := range d.fonts {
+		if f.String() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (d *fontComposeDialog) newOverride(source fyne.CanvasObject) *fontComposeOverride {
+	o := &fontComposeOverride{
+		first:       widget.NewEntry(),
+		count:       widget.NewEntry(),
+		sourceFirst: widget.NewEntry(),
+	}
+	o.first.SetPlaceHolder("First")
+	o.count.SetPlaceHolder("Count")
+	o.sourceFirst.SetPlaceHolder("From")
+	remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		d.removeOverride(o)
+	})
+	o.row = widget.NewHBox(source, o.first, o.count, o.sourceFirst, remove)
+	return o
+}
+
+func (d *fontComposeDialog) appendOverride(o *fontComposeOverride) {
+	d.overrides = append(d.overrides, o)
+	d.overridesBox.Append(o.row)
+}
+
+func (d *fontComposeDialog) removeOverride(o *fontComposeOverride) {
+	for ii, v := range d.overrides {
+		if v == o {
+			d.overrides = append(d.overrides[:ii], d.overrides[ii+1:]...)
+			break
+		}
+	}
+	var children []fyne.CanvasObject
+	for _, v := range d.overrides {
+		children = append(children, v.row)
+	}
+	d.overridesBox.Children = children
+	d.overridesBox.Refresh()
+}
+
+func (d *fontComposeDialog) addFontOverride() {
+	font := widget.NewSelect(d.fontNames(), nil)
+	o := d.newOverride(font)
+	o.font = font
+	d.appendOverride(o)
+}
+
+func (d *fontComposeDialog) selectImage() string {
+	filename, err := dlgs.File().Filter("Image (*.png)", "png").Load()
+	platformAfterFileDialog()
+	if err != nil {
+		if err != dlgs.ErrCancelled {
+			d.app.showError(err)
+		}
+		return ""
+	}
+	return filename
+}
+
+func (d *fontComposeDialog) addImageOverride() {
+	filename := d.selectImage()
+	if filename == "" {
+		return
+	}
+	o := d.newOverride(widget.NewLabel(filepath.Base(filename)))
+	o.imagePath = filename
+	o.sourceFirst.SetText("0")
+	o.sourceFirst.Disable()
+	d.appendOverride(o)
+}
+
+func (d *fontComposeDialog) addLogoOverride() {
+	filename := d.selectImage()
+	if filename == "" {
+		return
+	}
+	var logoNames []string
+	for _, l := range fonts.Logos() {
+		logoNames = append(logoNames, l.Name)
+	}
+	var o *fontComposeOverride
+	logo := widget.NewSelect(logoNames, func(name string) {
+		if l, err := fonts.LogoNamed(name); err == nil {
+			o.first.SetText(strconv.Itoa(l.First))
+			o.count.SetText(strconv.Itoa(l.Count()))
+		}
+	})
+	o = d.newOverride(widget.NewHBox(widget.NewLabel(filepath.Base(filename)), logo))
+	o.logo = logo
+	o.imagePath = filename
+	o.first.Disable()
+	o.count.Disable()
+	o.sourceFirst.SetText("0")
+	o.sourceFirst.Disable()
+	d.appendOverride(o)
+}
+
+func (d *fontComposeDialog) parseEntry(e *widget.Entry, name string) (int, error) {
+	val, err := strconv.Atoi(strings.TrimSpace(e.Text))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, e.Text)
+	}
+	return val, nil
+}
+
+func (d *fontComposeDialog) composition() (*fonts.Composition, error) {
+	base := d.findFont(d.base.Selected)
+	if base == nil {
+		return nil, errors.New("please, select a base font")
+	}
+	baseFont, err := fonts.DecodeFile(base.Path)
+	if err != nil {
+		return nil, err
+	}
+	c := &fonts.Composition{Base: baseFont}
+	for _, v := range d.overrides {
+		if v.logo != nil {
+			logo, err := fonts.LogoNamed(v.logo.Selected)
+			if err != nil {
+				return nil, errors.New("please, select a firmware for each logo")
+			}
+			im, err := fonts.DecodeImageFile(v.imagePath)
+			if err != nil {
+				return nil, err
+			}
+			c.Overrides = append(c.Overrides, logo.Override(im))
+			continue
+		}
+		o := &fonts.Override{}
+		if o.First, err = d.parseEntry(v.first, "first character"); err != nil {
+			return nil, err
+		}
+		if o.Count, err = d.parseEntry(v.count, "character count"); err != nil {
+			return nil, err
+		}
+		if v.font != nil {
+			f := d.findFont(v.font.Selected)
+			if f == nil {
+				return nil, errors.New("please, select a font for each font range")
+			}
+			if o.Font, err = fonts.DecodeFile(f.Path); err != nil {
+				return nil, err
+			}
+			if o.SourceFirst, err = d.parseEntry(v.sourceFirst, "source character"); err != nil {
+				return nil, err
+			}
+		} else {
+			if o.Image, err = fonts.DecodeImageFile(v.imagePath); err != nil {
+				return nil, err
+			}
+		}
+		c.Overrides = append(c.Overrides, o)
+	}
+	return c, nil
+}
+
+func (d *fontComposeDialog) encode() ([]byte, error) {
+	c, err := d.composition()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *fontComposeDialog) save() {
+	name := strings.TrimSpace(d.name.Text)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		d.app.showError(fmt.Errorf("invalid font name %q", d.name.Text))
+		return
+	}
+	data, err := d.encode()
+	if err != nil {
+		d.app.showError(err)
+		return
+	}
+	p := d.app.storagePath(path.Join(fontsDir, customFontsOrigin, name+fontsExt))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		d.app.showError(err)
+		return
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		d.app.showError(err)
+		return
+	}
+	d.dlg.Hide()
+	dialog.ShowInformation("Font saved", fmt.Sprintf("Font saved as %s / %s", customFontsOrigin, name), d.app.window)
+}
+
+func (d *fontComposeDialog) upload() {
+	data, err := d.encode()
+	if err != nil {
+		d.app.showError(err)
+		return
+	}
+	d.dlg.Hide()
+	var symbols *fonts.SymbolMap
+	if base := d.findFont(d.base.Selected); base != nil {
+		symbols, _ = fonts.SymbolMapNamed(base.Origin)
+	}
+	d.app.uploadFontData(bytes.NewReader(data), symbols)
+}
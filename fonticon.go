@@ -7,25 +7,26 @@ import (
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/canvas"
+	"fyne.io/fyne/driver/desktop"
+	"fyne.io/fyne/widget"
 
+	"github.com/fiam/max7456tool/mcm"
 	"github.com/icza/bitio"
 
 	"osdapp/frskyosd"
 )
 
-// FontIcon is a convenience type wrapping a canvas.Image
-// that allows setting font character data directly.
-type FontIcon struct {
-	canvas.Image
-}
-
-// SetFontData updates the icon to display the given font
-// data, which must be 54 bytes.
-func (i *FontIcon) SetFontData(data []byte) {
-	bg := color.Gray{
+var (
+	fontIconBackground = color.Gray{
 		Y: (255 * 3) / 4,
 	}
-	img := image.NewRGBA(image.Rect(0, 0, 12, 18))
+	fontIconHighlight = color.RGBA{R: 255, G: 200, B: 0, A: 255}
+)
+
+// fontCharImage returns an image for the given font data, which
+// must be 54 bytes, with each pixel scaled to scale x scale.
+func fontCharImage(data []byte, bg color.Color, scale int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, mcm.CharWidth*scale, mcm.CharHeight*scale))
 	for ii := 0; ii < img.Rect.Dx(); ii++ {
 		for jj := 0; jj < img.Rect.Dy(); jj++ {
 			img.Set(ii, jj, bg)
@@ -33,8 +34,8 @@ func (i *FontIcon) SetFontData(data []byte) {
 	}
 	if len(data) > 0 {
 		r := bitio.NewReader(bytes.NewReader(data))
-		for jj := 0; jj < img.Rect.Dy(); jj++ {
-			for ii := 0; ii < img.Rect.Dx(); ii++ {
+		for jj := 0; jj < mcm.CharHeight; jj++ {
+			for ii := 0; ii < mcm.CharWidth; ii++ {
 				var c color.Color = nil
 				pix, err := r.ReadBits(2)
 				if err != nil {
@@ -50,13 +51,85 @@ func (i *FontIcon) SetFontData(data []byte) {
 					c = color.Gray{Y: 127}
 				}
 				if c != nil {
-					img.Set(ii, jj, c)
+					for y := 0; y < scale; y++ {
+						for x := 0; x < scale; x++ {
+							img.Set(ii*scale+x, jj*scale+y, c)
+						}
+					}
 				}
 			}
 		}
 	}
-	i.Image.Image = img
-	i.Image.Refresh()
+	return img
+}
+
+type fontIconRenderer struct {
+	icon    *FontIcon
+	objects []fyne.CanvasObject
+}
+
+func (r *fontIconRenderer) Layout(size fyne.Size) {
+	r.icon.image.Resize(size)
+}
+
+func (r *fontIconRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(mcm.CharWidth, mcm.CharHeight)
+}
+
+func (r *fontIconRenderer) Refresh() {
+	canvas.Refresh(r.icon.image)
+}
+
+func (r *fontIconRenderer) BackgroundColor() color.Color {
+	return color.Transparent
+}
+
+func (r *fontIconRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *fontIconRenderer) Destroy() {}
+
+// FontIcon is a widget that displays a font character
+// and notifies when it's tapped or hovered.
+type FontIcon struct {
+	widget.BaseWidget
+	// Index is the index of the character in the font
+	Index       int
+	image       *canvas.Image
+	data        []byte
+	highlighted bool
+	// OnTapped is called when the icon is tapped
+	OnTapped func(fi *FontIcon)
+	// OnHovered is called when the mouse enters or leaves the icon
+	OnHovered func(fi *FontIcon, hovered bool)
+}
+
+var (
+	_ fyne.Tappable     = (*FontIcon)(nil)
+	_ desktop.Hoverable = (*FontIcon)(nil)
+)
+
+func (i *FontIcon) updateImage() {
+	bg := color.Color(fontIconBackground)
+	if i.highlighted {
+		bg = fontIconHighlight
+	}
+	i.image.Image = fontCharImage(i.data, bg, 1)
+	canvas.Refresh(i.image)
+}
+
+// SetFontData updates the icon to display the given font
+// data, which must be 54 bytes.
+func (i *FontIcon) SetFontData(data []byte) {
+	i.data = data
+	i.updateImage()
+}
+
+// FontData returns the font data displayed by the icon,
+// or nil if it's empty.
+func (i *FontIcon) FontData() []byte {
+	return i.data
 }
 
 // SetFont updates the displayed font image from a FontCharMessage
@@ -68,11 +141,63 @@ func (i *FontIcon) SetFont(msg *frskyosd.FontCharMessage) {
 	i.SetFontData(data)
 }
 
-// NewFontIcon returns a *FontIcon ready to be used
-func NewFontIcon() *FontIcon {
-	fi := &FontIcon{}
-	fi.Image.FillMode = canvas.ImageFillContain
-	fi.SetMinSize(fyne.NewSize(12, 18))
+// SetHighlighted changes the background of the icon
+// to make it stand out.
+func (i *FontIcon) SetHighlighted(highlighted bool) {
+	if i.highlighted != highlighted {
+		i.highlighted = highlighted
+		i.updateImage()
+	}
+}
+
+// MinSize returns the size that this widget should not shrink below
+func (i *FontIcon) MinSize() fyne.Size {
+	i.ExtendBaseWidget(i)
+	return i.BaseWidget.MinSize()
+}
+
+// CreateRenderer implements fyne.Widget
+func (i *FontIcon) CreateRenderer() fyne.WidgetRenderer {
+	i.ExtendBaseWidget(i)
+	return &fontIconRenderer{
+		icon:    i,
+		objects: []fyne.CanvasObject{i.image},
+	}
+}
+
+// Tapped implements fyne.Tappable
+func (i *FontIcon) Tapped(*fyne.PointEvent) {
+	if i.OnTapped != nil {
+		i.OnTapped(i)
+	}
+}
+
+// TappedSecondary implements fyne.Tappable
+func (i *FontIcon) TappedSecondary(*fyne.PointEvent) {}
+
+// MouseIn implements desktop.Hoverable
+func (i *FontIcon) MouseIn(*desktop.MouseEvent) {
+	if i.OnHovered != nil {
+		i.OnHovered(i, true)
+	}
+}
+
+// MouseOut implements desktop.Hoverable
+func (i *FontIcon) MouseOut() {
+	if i.OnHovered != nil {
+		i.OnHovered(i, false)
+	}
+}
+
+// MouseMoved implements desktop.Hoverable
+func (i *FontIcon) MouseMoved(*desktop.MouseEvent) {}
+
+// NewFontIcon returns a *FontIcon for the character at
+// the given index ready to be used
+func NewFontIcon(idx int) *FontIcon {
+	fi := &FontIcon{Index: idx}
+	fi.ExtendBaseWidget(fi)
+	fi.image = &canvas.Image{FillMode: canvas.ImageFillContain}
 	fi.SetFont(nil)
 	return fi
 }
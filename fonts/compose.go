@@ -0,0 +1,137 @@
+package fonts
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/fiam/max7456tool/mcm"
+)
+
+// Override replaces a range of characters in a composed font.
+// The replacement characters are taken either from another
+// font or from an image containing a grid of characters.
+type Override struct {
+	// First is the index of the first character to replace
+	First int
+	// Count is the number of characters to replace
+	Count int
+	// Font provides the replacement characters when non-nil
+	Font *mcm.Decoder
+	// SourceFirst is the index of the first character
+	// to copy from Font
+	SourceFirst int
+	// Image provides the replacement characters when non-nil.
+	// Characters are read left to right, top to bottom in
+	// blocks of mcm.CharWidth x mcm.CharHeight pixels. Colors
+	// are mapped to their nearest one in Palette.
+	Image image.Image
+}
+
+func (o *Override) chars() ([]*mcm.Char, error) {
+	if o.Count <= 0 {
+		return nil, fmt.Errorf("invalid override count %d", o.Count)
+	}
+	if o.First < 0 || o.First+o.Count > mcm.ExtendedCharNum {
+		return nil, fmt.Errorf("override range %d-%d is out of bounds 0-%d",
+			o.First, o.First+o.Count-1, mcm.ExtendedCharNum-1)
+	}
+	chars := make([]*mcm.Char, o.Count)
+	switch {
+	case o.Font != nil:
+		if o.SourceFirst < 0 || o.SourceFirst+o.Count > o.Font.NChars() {
+			return nil, fmt.Errorf("source range %d-%d is out of bounds 0-%d",
+				o.SourceFirst, o.SourceFirst+o.Count-1, o.Font.NChars()-1)
+		}
+		for ii := range chars {
+			chars[ii] = o.Font.CharAt(o.SourceFirst + ii)
+		}
+	case o.Image != nil:
+		im := Quantize(o.Image)
+		bounds := im.Bounds()
+		columns := bounds.Dx() / mcm.CharWidth
+		rows := bounds.Dy() / mcm.CharHeight
+		if columns*rows < o.Count {
+			return nil, fmt.Errorf("image of %dx%d pixels contains %d characters, need %d",
+				bounds.Dx(), bounds.Dy(), columns*rows, o.Count)
+		}
+		for ii := range chars {
+			x := (ii % columns) * mcm.CharWidth
+			y := (ii / columns) * mcm.CharHeight
+			chr, err := charFromImage(im, x, y)
+			if err != nil {
+				return nil, err
+			}
+			chars[ii] = chr
+		}
+	default:
+		return nil, errors.New("override has no font nor image")
+	}
+	return chars, nil
+}
+
+// Composition builds a new font from a base font and a list
+// of overrides, which are applied in order.
+type Composition struct {
+	Base      *mcm.Decoder
+	Overrides []*Override
+}
+
+// Chars returns the characters in the composed font, keyed
+// by their index.
+func (c *Composition) Chars() (map[int]*mcm.Char, error) {
+	if c.Base == nil {
+		return nil, errors.New("composition has no base font")
+	}
+	chars := make(map[int]*mcm.Char, mcm.ExtendedCharNum)
+	for ii := 0; ii < c.Base.NChars(); ii++ {
+		chars[ii] = c.Base.CharAt(ii)
+	}
+	for ii, o := range c.Overrides {
+		overrideChars, err := o.chars()
+		if err != nil {
+			return nil, fmt.Errorf("override %d: %v", ii+1, err)
+		}
+		for jj, chr := range overrideChars {
+			chars[o.First+jj] = chr
+		}
+	}
+	return chars, nil
+}
+
+// Encode writes the composed font to w in .mcm format. Missing
+// characters are filled with blank ones.
+func (c *Composition) Encode(w io.Writer) error {
+	chars, err := c.Chars()
+	if err != nil {
+		return err
+	}
+	enc := &mcm.Encoder{
+		Chars: chars,
+		Fill:  true,
+	}
+	return enc.Encode(w)
+}
+
+// DecodeFile decodes the .mcm file at the given path
+func DecodeFile(filename string) (*mcm.Decoder, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return mcm.NewDecoder(f)
+}
+
+// DecodeImageFile decodes the .png file at the given path
+func DecodeImageFile(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
@@ -0,0 +1,101 @@
+package fonts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConstantChar(t *testing.T, b byte) *mcm.Char {
+	data := make([]byte, mcm.CharBytes)
+	for ii := range data {
+		data[ii] = b
+	}
+	chr, err := mcm.NewCharFromData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chr
+}
+
+func testFont(t *testing.T, n int, b byte) *mcm.Decoder {
+	chars := make(map[int]*mcm.Char, n)
+	for ii := 0; ii < n; ii++ {
+		chars[ii] = testConstantChar(t, b)
+	}
+	var buf bytes.Buffer
+	enc := &mcm.Encoder{Chars: chars}
+	if err := enc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mcm.NewDecoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec
+}
+
+func TestCompositionFromFont(t *testing.T) {
+	base := testFont(t, mcm.ExtendedCharNum, 0x55)
+	other := testFont(t, mcm.CharNum, 0x00)
+	c := &Composition{
+		Base: base,
+		Overrides: []*Override{
+			{First: 300, Count: 10, Font: other, SourceFirst: 20},
+		},
+	}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mcm.NewDecoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, mcm.ExtendedCharNum, dec.NChars())
+	assert.True(t, dec.CharAt(299).IsBlank())
+	assert.False(t, dec.CharAt(300).IsBlank())
+	assert.False(t, dec.CharAt(309).IsBlank())
+	assert.True(t, dec.CharAt(310).IsBlank())
+}
+
+func TestCompositionFromImage(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, mcm.CharWidth*2, mcm.CharHeight))
+	for x := mcm.CharWidth; x < mcm.CharWidth*2; x++ {
+		for y := 0; y < mcm.CharHeight; y++ {
+			im.Set(x, y, color.White)
+		}
+	}
+	c := &Composition{
+		Base: testFont(t, mcm.CharNum, 0x55),
+		Overrides: []*Override{
+			{First: 400, Count: 2, Image: im},
+		},
+	}
+	chars, err := c.Chars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, chars[400].IsBlank())
+	assert.False(t, chars[401].IsBlank())
+}
+
+func TestCompositionErrors(t *testing.T) {
+	base := testFont(t, mcm.CharNum, 0x55)
+	invalid := []*Override{
+		{First: 0, Count: 0, Font: base},
+		{First: 510, Count: 4, Font: base},
+		{First: 0, Count: 10, Font: base, SourceFirst: 250},
+		{First: 0, Count: 10},
+		{First: 0, Count: 3, Image: image.NewRGBA(image.Rect(0, 0, mcm.CharWidth*2, mcm.CharHeight))},
+	}
+	for _, o := range invalid {
+		c := &Composition{Base: base, Overrides: []*Override{o}}
+		_, err := c.Chars()
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,169 @@
+package fonts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/fiam/max7456tool/mcm"
+)
+
+// CharRange represents an inclusive range of characters
+type CharRange struct {
+	First int
+	Last  int
+}
+
+func (r CharRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%d", r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// FormatCharRanges returns a user visible representation of
+// the given ranges.
+func FormatCharRanges(ranges []CharRange) string {
+	s := make([]string, len(ranges))
+	for ii, r := range ranges {
+		s[ii] = r.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Fingerprint identifies a font by the hashes of its characters.
+// Only the visible data is hashed, the metadata is ignored.
+type Fingerprint struct {
+	chars [][sha256.Size]byte
+}
+
+// NewFingerprint returns the Fingerprint for the given characters.
+// Each character must contain at least mcm.MinCharBytes.
+func NewFingerprint(chars [][]byte) (*Fingerprint, error) {
+	fp := &Fingerprint{
+		chars: make([][sha256.Size]byte, len(chars)),
+	}
+	for ii, c := range chars {
+		if len(c) < mcm.MinCharBytes {
+			return nil, fmt.Errorf("char %d has %d bytes, need at least %d", ii, len(c), mcm.MinCharBytes)
+		}
+		fp.chars[ii] = sha256.Sum256(c[:mcm.MinCharBytes])
+	}
+	return fp, nil
+}
+
+// FingerprintFont returns the Fingerprint for the given font
+func FingerprintFont(font *mcm.Decoder) *Fingerprint {
+	chars := make([][]byte, font.NChars())
+	for ii := range chars {
+		chars[ii] = font.CharAt(ii).Data()
+	}
+	fp, err := NewFingerprint(chars)
+	if err != nil {
+		// Can't happen, decoded chars always have mcm.CharBytes
+		panic(err)
+	}
+	return fp
+}
+
+// NChars returns the number of characters in the fingerprint
+func (f *Fingerprint) NChars() int {
+	return len(f.chars)
+}
+
+// Sum returns a hex encoded digest of the whole font
+func (f *Fingerprint) Sum() string {
+	h := sha256.New()
+	for _, c := range f.chars {
+		h.Write(c[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Diff returns the ranges of characters that differ between f
+// and other. Only the characters present in both fingerprints
+// are compared.
+func (f *Fingerprint) Diff(other *Fingerprint) []CharRange {
+	n := len(f.chars)
+	if len(other.chars) < n {
+		n = len(other.chars)
+	}
+	var ranges []CharRange
+	for ii := 0; ii < n; ii++ {
+		if f.chars[ii] == other.chars[ii] {
+			continue
+		}
+		ranges = appendCharRange(ranges, CharRange{First: ii, Last: ii})
+	}
+	return ranges
+}
+
+// FingerprintMatch is returned by Match
+type FingerprintMatch struct {
+	Name string
+	// Matching is the number of equal characters
+	Matching int
+	// Differences contains the ranges of characters that
+	// don't match, including the ones present in only one
+	// of the fonts
+	Differences []CharRange
+}
+
+// IsExact returns true iff both fonts have the same characters
+func (m *FingerprintMatch) IsExact() bool {
+	return len(m.Differences) == 0
+}
+
+// Match compares fp against the given candidate fingerprints,
+// keyed by name, and returns the one with the most matching
+// characters. If no candidate matches at least half of its
+// characters, it returns nil. Fonts with a different number of
+// characters never match exactly.
+func Match(fp *Fingerprint, candidates map[string]*Fingerprint) *FingerprintMatch {
+	var best *FingerprintMatch
+	for name, c := range candidates {
+		diff := c.Diff(fp)
+		compared := c.NChars()
+		if fp.NChars() < compared {
+			compared = fp.NChars()
+		}
+		if compared == 0 {
+			continue
+		}
+		different := 0
+		for _, r := range diff {
+			different += r.Last - r.First + 1
+		}
+		matching := compared - different
+		if matching*2 < compared {
+			continue
+		}
+		total := c.NChars()
+		if fp.NChars() > total {
+			total = fp.NChars()
+		}
+		if total > compared {
+			diff = appendCharRange(diff, CharRange{First: compared, Last: total - 1})
+		}
+		if best == nil || matching > best.Matching ||
+			(matching == best.Matching && name < best.Name) {
+			best = &FingerprintMatch{
+				Name:        name,
+				Matching:    matching,
+				Differences: diff,
+			}
+		}
+	}
+	return best
+}
+
+// appendCharRange appends r to ranges, merging it with the last
+// range if they're contiguous
+func appendCharRange(ranges []CharRange, r CharRange) []CharRange {
+	if len(ranges) > 0 && ranges[len(ranges)-1].Last == r.First-1 {
+		ranges[len(ranges)-1].Last = r.Last
+		return ranges
+	}
+	return append(ranges, r)
+}
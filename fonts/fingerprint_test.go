@@ -0,0 +1,58 @@
+package fonts
+
+import (
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintMatch(t *testing.T) {
+	base := testFont(t, mcm.ExtendedCharNum, 0x00)
+	c := &Composition{
+		Base: base,
+		Overrides: []*Override{
+			{First: 257, Count: 24, Font: testFont(t, mcm.CharNum, 0x55)},
+			{First: 400, Count: 1, Font: testFont(t, mcm.CharNum, 0xaa)},
+		},
+	}
+	chars, err := c.Chars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := FingerprintFont(testFontFromMap(t, chars))
+	candidates := map[string]*Fingerprint{
+		"Base":  FingerprintFont(base),
+		"Other": FingerprintFont(testFont(t, mcm.ExtendedCharNum, 0xff)),
+	}
+
+	m := Match(FingerprintFont(base), candidates)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "Base", m.Name)
+		assert.True(t, m.IsExact())
+	}
+
+	m = Match(modified, candidates)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "Base", m.Name)
+		assert.False(t, m.IsExact())
+		assert.Equal(t, []CharRange{{257, 280}, {400, 400}}, m.Differences)
+		assert.Equal(t, "257-280, 400", FormatCharRanges(m.Differences))
+	}
+
+	assert.Nil(t, Match(FingerprintFont(testFont(t, mcm.ExtendedCharNum, 0xaa)), candidates))
+
+	// A font with only the lower half of the characters doesn't
+	// match exactly, even if the ones it has are equal
+	m = Match(FingerprintFont(testFont(t, mcm.CharNum, 0x00)), candidates)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "Base", m.Name)
+		assert.False(t, m.IsExact())
+		assert.Equal(t, []CharRange{{mcm.CharNum, mcm.ExtendedCharNum - 1}}, m.Differences)
+	}
+	m = Match(modified, map[string]*Fingerprint{"Half": FingerprintFont(testFont(t, mcm.CharNum, 0x00))})
+	if assert.NotNil(t, m) {
+		assert.Equal(t, []CharRange{{256, 511}}, m.Differences)
+	}
+	assert.NotEqual(t, FingerprintFont(base).Sum(), modified.Sum())
+}
@@ -4,14 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"path/filepath"
 	"sort"
 	"strings"
 	"unicode"
 
-	"github.com/google/go-github/github"
+	"osdapp/internal/httpclient"
 )
 
 type Font struct {
@@ -20,7 +19,7 @@ type Font struct {
 }
 
 func (f Font) Open() (io.ReadCloser, error) {
-	resp, err := http.Get(f.URL)
+	resp, err := httpclient.Default().Get(f.URL)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +56,7 @@ func (o *gitHubDirFontOrigin) Fonts() ([]Font, error) {
 	}
 	parts := strings.Split(u.Path[1:], "/")
 	repoPath := strings.Join(parts[2:], "/")
-	c := github.NewClient(nil)
+	c := httpclient.GitHub()
 	_, dirContents, _, err := c.Repositories.GetContents(context.Background(), parts[0], parts[1], repoPath, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,213 @@
+package fonts
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/fiam/max7456tool/mcm"
+)
+
+const (
+	// Pixels with an alpha below this threshold are
+	// considered transparent
+	alphaThreshold = 0x8000
+	// mcmTransparentByte represents 4 transparent pixels
+	mcmTransparentByte = 0x55
+)
+
+// Palette contains the colors that can be displayed by the OSD.
+// The index of each color corresponds to its mcm.Pixel value.
+var Palette = color.Palette{
+	mcm.PixelBlack:       color.RGBA{R: 0, G: 0, B: 0, A: 255},
+	mcm.PixelTransparent: color.RGBA{R: 0, G: 0, B: 0, A: 0},
+	mcm.PixelWhite:       color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	mcm.PixelGray:        color.RGBA{R: 128, G: 128, B: 128, A: 255},
+}
+
+// luminance returns the luminance of c in the [0, 0xffff] range
+// as well as its alpha.
+func luminance(c color.Color) (y int, a uint32) {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return 0, 0
+	}
+	// Undo the alpha premultiplication
+	r = r * 0xffff / a
+	g = g * 0xffff / a
+	b = b * 0xffff / a
+	return int((299*r + 587*g + 114*b) / 1000), a
+}
+
+// nearestPixel returns the pixel value closest to the
+// given luminance, ignoring transparency.
+func nearestPixel(y int) mcm.Pixel {
+	switch {
+	case y < 0x4000:
+		return mcm.PixelBlack
+	case y < 0xc000:
+		return mcm.PixelGray
+	}
+	return mcm.PixelWhite
+}
+
+func pixelLuminance(p mcm.Pixel) int {
+	switch p {
+	case mcm.PixelBlack:
+		return 0
+	case mcm.PixelGray:
+		return 0x8080
+	}
+	return 0xffff
+}
+
+// Quantize returns an image using only the colors in Palette,
+// mapping each pixel to its nearest color.
+func Quantize(im image.Image) *image.Paletted {
+	if p, ok := im.(*image.Paletted); ok && isOSDPalette(p.Palette) {
+		return p
+	}
+	bounds := im.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), Palette)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			lum, a := luminance(im.At(bounds.Min.X+x, bounds.Min.Y+y))
+			var p mcm.Pixel = mcm.PixelTransparent
+			if a >= alphaThreshold {
+				p = nearestPixel(lum)
+			}
+			dst.SetColorIndex(x, y, uint8(p))
+		}
+	}
+	return dst
+}
+
+// Dither returns an image using only the colors in Palette,
+// using Floyd-Steinberg error diffusion on the luminance of
+// the opaque pixels.
+func Dither(im image.Image) *image.Paletted {
+	bounds := im.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dst := image.NewPaletted(image.Rect(0, 0, w, h), Palette)
+	lums := make([]int, w*h)
+	opaque := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			lum, a := luminance(im.At(bounds.Min.X+x, bounds.Min.Y+y))
+			lums[y*w+x] = lum
+			opaque[y*w+x] = a >= alphaThreshold
+		}
+	}
+	diffuse := func(x, y int, e int) {
+		if x >= 0 && x < w && y < h && opaque[y*w+x] {
+			lums[y*w+x] += e
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !opaque[y*w+x] {
+				dst.SetColorIndex(x, y, uint8(mcm.PixelTransparent))
+				continue
+			}
+			lum := lums[y*w+x]
+			p := nearestPixel(lum)
+			dst.SetColorIndex(x, y, uint8(p))
+			e := lum - pixelLuminance(p)
+			diffuse(x+1, y, e*7/16)
+			diffuse(x-1, y+1, e*3/16)
+			diffuse(x, y+1, e*5/16)
+			diffuse(x+1, y+1, e*1/16)
+		}
+	}
+	return dst
+}
+
+// Scale returns a w x h image with im scaled to fit inside
+// it while preserving its aspect ratio. The scaled image is
+// centered and the rest is left transparent.
+func Scale(im image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	bounds := im.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	// Fit keeping the aspect ratio
+	dw, dh := w, sh*w/sw
+	if dh > h {
+		dw, dh = sw*h/sh, h
+	}
+	if dw == 0 || dh == 0 {
+		return dst
+	}
+	ox := (w - dw) / 2
+	oy := (h - dh) / 2
+	for y := 0; y < dh; y++ {
+		sy0 := y * sh / dh
+		sy1 := (y + 1) * sh / dh
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			sx0 := x * sw / dw
+			sx1 := (x + 1) * sw / dw
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			// Average the source area covered by this pixel
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := im.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r += cr
+					g += cg
+					b += cb
+					a += ca
+					n++
+				}
+			}
+			dst.Set(ox+x, oy+y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+func isOSDPalette(p color.Palette) bool {
+	if len(p) != len(Palette) {
+		return false
+	}
+	for ii := range p {
+		r1, g1, b1, a1 := p[ii].RGBA()
+		r2, g2, b2, a2 := Palette[ii].RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			return false
+		}
+	}
+	return true
+}
+
+// charFromImage returns the character at (x0, y0) in im, which
+// must use Palette. Pixels outside of im are left transparent.
+func charFromImage(im *image.Paletted, x0, y0 int) (*mcm.Char, error) {
+	data := make([]byte, mcm.CharBytes)
+	for ii := mcm.MinCharBytes; ii < len(data); ii++ {
+		data[ii] = mcmTransparentByte
+	}
+	bounds := im.Bounds()
+	for y := 0; y < mcm.CharHeight; y++ {
+		for x := 0; x < mcm.CharWidth; x++ {
+			var p mcm.Pixel = mcm.PixelTransparent
+			px, py := bounds.Min.X+x0+x, bounds.Min.Y+y0+y
+			if image.Pt(px, py).In(bounds) {
+				p = mcm.Pixel(im.ColorIndexAt(px, py))
+			}
+			pos := y*mcm.CharWidth + x
+			data[pos/4] |= byte(p) << uint(6-(pos%4)*2)
+		}
+	}
+	return mcm.NewCharFromData(data)
+}
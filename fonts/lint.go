@@ -0,0 +1,112 @@
+package fonts
+
+import (
+	"fmt"
+
+	"github.com/fiam/max7456tool/mcm"
+)
+
+// LintSeverity indicates how serious a LintIssue is
+type LintSeverity int
+
+const (
+	// LintWarning indicates a problem that might cause
+	// minor issues when the font is displayed
+	LintWarning LintSeverity = iota + 1
+	// LintError indicates a problem that will make the
+	// OSD display incorrect or missing information
+	LintError
+)
+
+func (s LintSeverity) String() string {
+	switch s {
+	case LintWarning:
+		return "warning"
+	case LintError:
+		return "error"
+	}
+	return fmt.Sprintf("unknown %T = %d", s, int(s))
+}
+
+// LintIssue represents a problem found by Lint
+type LintIssue struct {
+	Severity LintSeverity
+	// Index of the character with the problem or -1 if
+	// the issue affects the whole font
+	Index   int
+	Message string
+}
+
+func (i *LintIssue) String() string {
+	if i.Index < 0 {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: char %d: %s", i.Severity, i.Index, i.Message)
+}
+
+// Lint checks the given font for common problems. If symbols
+// is non-nil, the font is also checked against the characters
+// required by that firmware.
+func Lint(font *mcm.Decoder, symbols *SymbolMap) []*LintIssue {
+	var issues []*LintIssue
+	addIssue := func(sev LintSeverity, idx int, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{
+			Severity: sev,
+			Index:    idx,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+	n := font.NChars()
+	switch n {
+	case mcm.ExtendedCharNum:
+	case mcm.CharNum:
+		addIssue(LintWarning, -1, "font has only %d characters, the OSD expects %d",
+			mcm.CharNum, mcm.ExtendedCharNum)
+	default:
+		addIssue(LintError, -1, "font has %d characters, the OSD expects %d",
+			n, mcm.ExtendedCharNum)
+	}
+	if symbols != nil {
+		for _, s := range symbols.Symbols() {
+			if !s.Required {
+				continue
+			}
+			if s.Index >= n {
+				addIssue(LintError, s.Index, "required %s symbol %q is missing", symbols.Name, s.Name)
+				continue
+			}
+			if isVisibleBlank(font.CharAt(s.Index)) {
+				addIssue(LintError, s.Index, "required %s symbol %q is blank", symbols.Name, s.Name)
+			}
+		}
+	}
+	for ii := 0; ii < n; ii++ {
+		chr := font.CharAt(ii)
+		if isVisibleBlank(chr) && !chr.MetadataIsBlank() {
+			addIssue(LintWarning, ii, "blank character has non-blank metadata")
+		}
+	}
+	return issues
+}
+
+// isVisibleBlank returns true iff all the visible pixels in
+// the character are transparent, ignoring its metadata.
+func isVisibleBlank(chr *mcm.Char) bool {
+	for _, b := range chr.Data()[:mcm.MinCharBytes] {
+		if b != mcmTransparentByte {
+			return false
+		}
+	}
+	return true
+}
+
+// LintHasErrors returns true iff any of the issues has
+// LintError severity.
+func LintHasErrors(issues []*LintIssue) bool {
+	for _, v := range issues {
+		if v.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package fonts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFontFromChars returns a font with the given characters
+// starting at index 0, filling the rest with blank ones
+func testFontFromChars(t *testing.T, chars ...*mcm.Char) *mcm.Decoder {
+	m := make(map[int]*mcm.Char, len(chars))
+	for ii, c := range chars {
+		m[ii] = c
+	}
+	return testFontFromMap(t, m)
+}
+
+// testFontFromMap returns a font with the given characters,
+// filling the missing ones with blank characters
+func testFontFromMap(t *testing.T, chars map[int]*mcm.Char) *mcm.Decoder {
+	var buf bytes.Buffer
+	enc := &mcm.Encoder{Chars: chars, Fill: true}
+	if err := enc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mcm.NewDecoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec
+}
+
+func TestLintValidFont(t *testing.T) {
+	font := testFont(t, mcm.ExtendedCharNum, 0x00)
+	for _, symbols := range SymbolMaps() {
+		assert.Empty(t, Lint(font, symbols), "unexpected issues for %s", symbols.Name)
+	}
+}
+
+func TestLintBlankFont(t *testing.T) {
+	font := testFont(t, mcm.CharNum, 0x55)
+	symbols, err := SymbolMapNamed("INAV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := Lint(font, symbols)
+	assert.True(t, LintHasErrors(issues))
+	assert.Equal(t, LintWarning, issues[0].Severity)
+	assert.Equal(t, -1, issues[0].Index)
+	var blankRSSI bool
+	for _, v := range issues {
+		if v.Index == 0x01 && v.Severity == LintError {
+			blankRSSI = true
+		}
+	}
+	assert.True(t, blankRSSI)
+}
+
+func TestLintMetadata(t *testing.T) {
+	data := make([]byte, mcm.CharBytes)
+	for ii := range data {
+		data[ii] = 0x55
+	}
+	data[mcm.CharBytes-1] = 0x00
+	chr, err := mcm.NewCharFromData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Composition{
+		Base: testFont(t, mcm.ExtendedCharNum, 0x00),
+		Overrides: []*Override{
+			{First: 10, Count: 1, Font: testFontFromChars(t, chr)},
+		},
+	}
+	chars, err := c.Chars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := Lint(testFontFromMap(t, chars), nil)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, 10, issues[0].Index)
+		assert.False(t, LintHasErrors(issues))
+	}
+}
+
+func TestSymbolMapSearch(t *testing.T) {
+	for _, symbols := range SymbolMaps() {
+		found := symbols.Search("rssi")
+		if assert.Len(t, found, 1) {
+			assert.Equal(t, 0x01, found[0].Index)
+		}
+		assert.Empty(t, symbols.Search(""))
+		assert.NotEmpty(t, symbols.Search("logo"))
+	}
+}
@@ -0,0 +1,83 @@
+package fonts
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/fiam/max7456tool/mcm"
+)
+
+// Logo describes the block of characters that a flight
+// controller firmware uses to draw its boot logo. Characters
+// in the block are laid out left to right, top to bottom.
+type Logo struct {
+	// Name of the firmware using this logo
+	Name    string
+	First   int
+	Columns int
+	Rows    int
+}
+
+// Count returns the number of characters in the logo
+func (l *Logo) Count() int {
+	return l.Columns * l.Rows
+}
+
+// Size returns the logo size in pixels
+func (l *Logo) Size() (w, h int) {
+	return l.Columns * mcm.CharWidth, l.Rows * mcm.CharHeight
+}
+
+// Image scales im to fit the logo and dithers it to Palette
+func (l *Logo) Image(im image.Image) *image.Paletted {
+	w, h := l.Size()
+	return Dither(Scale(im, w, h))
+}
+
+// Chars converts im into the characters for the logo, keyed
+// by their index in the font. See Logo.Image for how im is
+// transformed.
+func (l *Logo) Chars(im image.Image) (map[int]*mcm.Char, error) {
+	logo := l.Image(im)
+	chars := make(map[int]*mcm.Char, l.Count())
+	for ii := 0; ii < l.Count(); ii++ {
+		x := (ii % l.Columns) * mcm.CharWidth
+		y := (ii / l.Columns) * mcm.CharHeight
+		chr, err := charFromImage(logo, x, y)
+		if err != nil {
+			return nil, err
+		}
+		chars[l.First+ii] = chr
+	}
+	return chars, nil
+}
+
+// Override returns an Override that replaces the logo
+// characters with im, for use in a Composition.
+func (l *Logo) Override(im image.Image) *Override {
+	return &Override{
+		First: l.First,
+		Count: l.Count(),
+		Image: l.Image(im),
+	}
+}
+
+// Logos returns the logo blocks used by the supported firmwares
+func Logos() []*Logo {
+	return []*Logo{
+		// SYM_LOGO_START in INAV, 6x4 chars starting at 0x101
+		{Name: "INAV", First: 0x101, Columns: 6, Rows: 4},
+		// 24x4 chars starting at 0xA0 (160)
+		{Name: "Betaflight", First: 0xa0, Columns: 24, Rows: 4},
+	}
+}
+
+// LogoNamed returns the logo for the firmware with the given name
+func LogoNamed(name string) (*Logo, error) {
+	for _, l := range Logos() {
+		if l.Name == name {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no logo for firmware %q", name)
+}
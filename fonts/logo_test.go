@@ -0,0 +1,56 @@
+package fonts
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogoChars(t *testing.T) {
+	// Horizontal gradient with a transparent top half
+	im := image.NewNRGBA(image.Rect(0, 0, 300, 100))
+	for x := 0; x < 300; x++ {
+		for y := 50; y < 100; y++ {
+			im.Set(x, y, color.NRGBA{R: uint8(x * 255 / 299), G: uint8(x * 255 / 299), B: uint8(x * 255 / 299), A: 255})
+		}
+	}
+	for _, logo := range Logos() {
+		chars, err := logo.Chars(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, logo.Count(), len(chars))
+		for ii := logo.First; ii < logo.First+logo.Count(); ii++ {
+			assert.NotNil(t, chars[ii], "missing char %d in %s logo", ii, logo.Name)
+		}
+		// Top left corner is transparent, but the logo isn't
+		assert.True(t, chars[logo.First].IsBlank())
+		blank := true
+		for _, c := range chars {
+			if !c.IsBlank() {
+				blank = false
+			}
+		}
+		assert.False(t, blank)
+		assert.True(t, chars[logo.First].MetadataIsBlank())
+	}
+}
+
+func TestDitherPalette(t *testing.T) {
+	im := image.NewGray(image.Rect(0, 0, 16, 16))
+	for ii := range im.Pix {
+		im.Pix[ii] = uint8(ii)
+	}
+	d := Dither(im)
+	seen := make(map[uint8]bool)
+	for _, v := range d.Pix {
+		seen[v] = true
+	}
+	assert.True(t, seen[uint8(mcm.PixelBlack)])
+	assert.True(t, seen[uint8(mcm.PixelGray)])
+	assert.True(t, seen[uint8(mcm.PixelWhite)])
+	assert.False(t, seen[uint8(mcm.PixelTransparent)])
+}
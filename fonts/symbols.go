@@ -0,0 +1,188 @@
+package fonts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Symbol describes how a firmware uses a character in the font
+type Symbol struct {
+	Index int
+	Name  string
+	// Required indicates that the firmware can't display
+	// its OSD correctly if the character is blank
+	Required bool
+}
+
+func (s *Symbol) String() string {
+	return fmt.Sprintf("%s (%d)", s.Name, s.Index)
+}
+
+// SymbolMap maps font character indexes to the symbols
+// used by a firmware.
+type SymbolMap struct {
+	// Name of the firmware. Matches the origin name returned
+	// by FontOrigin.Name().
+	Name    string
+	symbols map[int]*Symbol
+}
+
+func newSymbolMap(name string) *SymbolMap {
+	return &SymbolMap{
+		Name:    name,
+		symbols: make(map[int]*Symbol),
+	}
+}
+
+func (m *SymbolMap) add(idx int, name string, required bool) {
+	m.symbols[idx] = &Symbol{Index: idx, Name: name, Required: required}
+}
+
+// addASCII adds the digits and the uppercase letters, which are
+// stored at their ASCII positions by every supported firmware.
+func (m *SymbolMap) addASCII() {
+	for c := '0'; c <= '9'; c++ {
+		m.add(int(c), fmt.Sprintf("Digit %c", c), true)
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		m.add(int(c), fmt.Sprintf("Letter %c", c), true)
+	}
+	for _, c := range ".:-/%" {
+		m.add(int(c), fmt.Sprintf("Punctuation %c", c), false)
+	}
+}
+
+func (m *SymbolMap) addRange(first int, count int, name string, required bool) {
+	for ii := 0; ii < count; ii++ {
+		m.add(first+ii, fmt.Sprintf("%s %d", name, ii+1), required)
+	}
+}
+
+func (m *SymbolMap) addLogo() {
+	if logo, err := LogoNamed(m.Name); err == nil {
+		m.addRange(logo.First, logo.Count(), "Logo", false)
+	}
+}
+
+// Symbol returns the symbol at the given index or nil
+// if the firmware doesn't use that character.
+func (m *SymbolMap) Symbol(idx int) *Symbol {
+	return m.symbols[idx]
+}
+
+// Symbols returns all the symbols in the map sorted by index
+func (m *SymbolMap) Symbols() []*Symbol {
+	symbols := make([]*Symbol, 0, len(m.symbols))
+	for _, s := range m.symbols {
+		symbols = append(symbols, s)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// Search returns the symbols whose name contains the
+// given query, ignoring case, sorted by index.
+func (m *SymbolMap) Search(query string) []*Symbol {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+	var found []*Symbol
+	for _, s := range m.Symbols() {
+		if strings.Contains(strings.ToLower(s.Name), query) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func newINAVSymbolMap() *SymbolMap {
+	m := newSymbolMap("INAV")
+	m.addASCII()
+	m.add(0x01, "RSSI", true)
+	m.add(0x02, "Artificial horizon right", false)
+	m.add(0x03, "Artificial horizon left", false)
+	m.add(0x04, "Throttle", true)
+	m.add(0x1e, "GPS satellites left", false)
+	m.add(0x1f, "GPS satellites right", false)
+	m.addRange(0x60, 16, "Direction arrow", true)
+	m.addRange(0x80, 9, "Artificial horizon bar", false)
+	m.addRange(0x90, 7, "Battery", true)
+	m.add(0x99, "mAh", false)
+	m.add(0x9a, "Amps", false)
+	m.add(0xa6, "Latitude", false)
+	m.add(0xa7, "Longitude", false)
+	m.addLogo()
+	return m
+}
+
+func newBetaflightSymbolMap() *SymbolMap {
+	m := newSymbolMap("Betaflight")
+	m.addASCII()
+	m.add(0x01, "RSSI", true)
+	m.add(0x02, "Artificial horizon right", false)
+	m.add(0x03, "Artificial horizon left", false)
+	m.add(0x04, "Throttle", true)
+	m.add(0x05, "Over home", false)
+	m.add(0x06, "Voltage", true)
+	m.add(0x07, "mAh", true)
+	m.add(0x0c, "Meters", false)
+	m.add(0x0d, "Fahrenheit", false)
+	m.add(0x0e, "Celsius", false)
+	m.add(0x0f, "Feet", false)
+	m.add(0x10, "Blackbox log", false)
+	m.add(0x11, "Home flag", false)
+	m.add(0x12, "RPM", false)
+	m.add(0x13, "Artificial horizon decoration", false)
+	m.add(0x14, "Roll", false)
+	m.add(0x15, "Pitch", false)
+	m.add(0x1e, "GPS satellites left", false)
+	m.add(0x1f, "GPS satellites right", false)
+	m.add(0x24, "Max", false)
+	m.add(0x25, "Profile", false)
+	m.addRange(0x60, 16, "Direction arrow", true)
+	m.add(0x70, "Speed", false)
+	m.add(0x72, "Artificial horizon center line", false)
+	m.add(0x73, "Artificial horizon center", true)
+	m.add(0x74, "Artificial horizon center line right", false)
+	m.add(0x7a, "Temperature", false)
+	m.add(0x7b, "Link quality", false)
+	m.add(0x7d, "Kilometers", false)
+	m.add(0x7e, "Miles", false)
+	m.add(0x7f, "Altitude", false)
+	m.addRange(0x80, 9, "Artificial horizon bar", false)
+	m.add(0x89, "Latitude", false)
+	m.addRange(0x90, 7, "Battery", true)
+	m.add(0x98, "Longitude", false)
+	m.add(0x9a, "Amps", false)
+	m.add(0x9b, "On time", false)
+	m.add(0x9c, "Fly time", false)
+	m.add(0x9d, "MPH", false)
+	m.add(0x9e, "KPH", false)
+	m.addLogo()
+	return m
+}
+
+var (
+	inavSymbols       = newINAVSymbolMap()
+	betaflightSymbols = newBetaflightSymbolMap()
+)
+
+// SymbolMaps returns the symbol maps for the supported firmwares
+func SymbolMaps() []*SymbolMap {
+	return []*SymbolMap{inavSymbols, betaflightSymbols}
+}
+
+// SymbolMapNamed returns the symbol map for the firmware with the
+// given name.
+func SymbolMapNamed(name string) (*SymbolMap, error) {
+	for _, m := range SymbolMaps() {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("no symbol map for firmware %q", name)
+}
@@ -0,0 +1,101 @@
+package frskyosd
+
+import (
+	"errors"
+
+	"osdapp/internal/osdversion"
+)
+
+var (
+	// ErrUnsupported is returned when the OSD doesn't support
+	// the requested operation, either because its firmware is
+	// too old or because it's running the bootloader.
+	ErrUnsupported = errors.New("operation not supported by the OSD firmware")
+
+	// settingsVersion is the first version with support for settings
+	settingsVersion = osdversion.MustParse("2.0.0-beta.1")
+	// widgetsVersion is the first version with support for widgets
+	widgetsVersion = osdversion.MustParse("2.0.0")
+)
+
+// Capabilities indicates the features supported by an OSD,
+// derived from its InfoMessage.
+type Capabilities struct {
+	// Version is the firmware version, zero in bootloader mode
+	Version osdversion.Version
+	// Bootloader is true when the OSD is running the bootloader,
+	// in which case only flashing is supported.
+	Bootloader bool
+	// Fonts indicates support for reading and writing the font
+	Fonts bool
+	// Settings indicates support for reading and writing settings,
+	// as well as retrieving the active camera.
+	Settings bool
+	// Drawing indicates support for the drawing commands
+	Drawing bool
+	// Widgets indicates support for the OSD side widgets
+	Widgets bool
+	// MaxFrameSize is the maximum size of a frame sent to the OSD
+	MaxFrameSize int
+	// ContextStackSize is the number of drawing contexts that can
+	// be saved
+	ContextStackSize int
+}
+
+// NewCapabilities returns the Capabilities for an OSD that
+// replied with the given InfoMessage.
+func NewCapabilities(info *InfoMessage) *Capabilities {
+	if info.IsBootloader {
+		return &Capabilities{Bootloader: true}
+	}
+	v := info.FirmwareVersion()
+	return &Capabilities{
+		Version:          v,
+		Fonts:            true,
+		Settings:         v.AtLeast(settingsVersion),
+		Drawing:          info.MaxFrameSize > 0,
+		Widgets:          v.AtLeast(widgetsVersion),
+		MaxFrameSize:     int(info.MaxFrameSize),
+		ContextStackSize: int(info.ContextStackSize),
+	}
+}
+
+// Capabilities returns the features supported by the OSD. They're
+// updated every time Info is called.
+func (o *OSD) Capabilities() (*Capabilities, error) {
+	o.mu.Lock()
+	caps := o.caps
+	o.mu.Unlock()
+	if caps != nil {
+		return caps, nil
+	}
+	if _, err := o.Info(); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.caps, nil
+}
+
+func (o *OSD) setCapabilities(caps *Capabilities) {
+	o.mu.Lock()
+	o.caps = caps
+	o.mu.Unlock()
+}
+
+// require returns ErrUnsupported if the OSD is known to not
+// support the feature checked by has. If the capabilities
+// are still unknown, the operation is allowed.
+func (o *OSD) require(has func(caps *Capabilities) bool) error {
+	o.mu.Lock()
+	caps := o.caps
+	o.mu.Unlock()
+	if caps != nil && !has(caps) {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func hasFonts(caps *Capabilities) bool    { return caps.Fonts }
+func hasSettings(caps *Capabilities) bool { return caps.Settings }
+func hasDrawing(caps *Capabilities) bool  { return caps.Drawing }
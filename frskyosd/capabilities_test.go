@@ -0,0 +1,60 @@
+package frskyosd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testInfo(major, minor, patch uint8) *InfoMessage {
+	info := &InfoMessage{MaxFrameSize: 256, ContextStackSize: 4}
+	info.Version.Major = major
+	info.Version.Minor = minor
+	info.Version.Patch = patch
+	return info
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := NewCapabilities(&InfoMessage{IsBootloader: true})
+	assert.True(t, caps.Bootloader)
+	assert.False(t, caps.Fonts)
+	assert.False(t, caps.Settings)
+	assert.False(t, caps.Drawing)
+
+	caps = NewCapabilities(testInfo(1, 0, 0))
+	assert.False(t, caps.Bootloader)
+	assert.True(t, caps.Fonts)
+	assert.False(t, caps.Settings)
+	assert.True(t, caps.Drawing)
+	assert.False(t, caps.Widgets)
+	assert.Equal(t, 256, caps.MaxFrameSize)
+	assert.Equal(t, 4, caps.ContextStackSize)
+
+	caps = NewCapabilities(testInfo(1, 99, 0))
+	assert.True(t, caps.Settings)
+	assert.False(t, caps.Widgets)
+
+	caps = NewCapabilities(testInfo(2, 0, 0))
+	assert.True(t, caps.Settings)
+	assert.True(t, caps.Widgets)
+}
+
+func TestRequire(t *testing.T) {
+	o := &OSD{}
+	// Unknown capabilities allow everything
+	assert.NoError(t, o.require(hasSettings))
+
+	o.setCapabilities(NewCapabilities(testInfo(1, 0, 0)))
+	assert.Equal(t, ErrUnsupported, o.require(hasSettings))
+	assert.NoError(t, o.require(hasFonts))
+
+	_, err := o.ReadSettings()
+	assert.Equal(t, ErrUnsupported, err)
+	_, err = o.ActiveCamera()
+	assert.Equal(t, ErrUnsupported, err)
+
+	o.setCapabilities(NewCapabilities(&InfoMessage{IsBootloader: true}))
+	assert.Equal(t, ErrUnsupported, o.ClearScreen())
+	_, err = o.ReadFontChar(0)
+	assert.Equal(t, ErrUnsupported, err)
+}
@@ -32,16 +32,25 @@ func (o *OSD) pack2int12(x int, y int) ([]byte, error) {
 	return buf[:3], nil
 }
 
+// sendDrawing sends a drawing command, returning ErrUnsupported
+// if the OSD doesn't support drawing.
+func (o *OSD) sendDrawing(cmd osdCmd, data []byte) error {
+	if err := o.require(hasDrawing); err != nil {
+		return err
+	}
+	return o.send(cmd, data)
+}
+
 func (o *OSD) TransactionBegin() error {
-	return o.send(cmdTransactionBegin, nil)
+	return o.sendDrawing(cmdTransactionBegin, nil)
 }
 
 func (o *OSD) TransactionCommit() error {
-	return o.send(cmdTransactionCommit, nil)
+	return o.sendDrawing(cmdTransactionCommit, nil)
 }
 
 func (o *OSD) TransactionBeginResettingDrawing() error {
-	return o.send(cmdTransactionBeginResetDrawing, nil)
+	return o.sendDrawing(cmdTransactionBeginResetDrawing, nil)
 }
 
 func (o *OSD) checkColor(c Color) error {
@@ -55,7 +64,7 @@ func (o *OSD) setColor(cmd osdCmd, c Color) error {
 	if err := o.checkColor(c); err != nil {
 		return err
 	}
-	return o.send(cmd, []byte{byte(c)})
+	return o.sendDrawing(cmd, []byte{byte(c)})
 }
 
 func (o *OSD) SetStrokeColor(c Color) error {
@@ -67,15 +76,15 @@ func (o *OSD) SetFillColor(c Color) error {
 }
 
 func (o *OSD) SetStrokeWidth(w int) error {
-	return o.send(cmdSetStrokeColor, []byte{byte(w)})
+	return o.sendDrawing(cmdSetStrokeWidth, []byte{byte(w)})
 }
 
 func (o *OSD) ClearScreen() error {
-	return o.send(cmdClearScreen, nil)
+	return o.sendDrawing(cmdClearScreen, nil)
 }
 
 func (o *OSD) ResetDrawing() error {
-	return o.send(cmdDrawingReset, nil)
+	return o.sendDrawing(cmdDrawingReset, nil)
 }
 
 func (o *OSD) MoveToPoint(x int, y int) error {
@@ -83,7 +92,7 @@ func (o *OSD) MoveToPoint(x int, y int) error {
 	if err != nil {
 		return err
 	}
-	return o.send(cmdMoveToPoint, data)
+	return o.sendDrawing(cmdMoveToPoint, data)
 }
 
 func (o *OSD) StrokeLineToPoint(x int, y int) error {
@@ -91,7 +100,7 @@ func (o *OSD) StrokeLineToPoint(x int, y int) error {
 	if err != nil {
 		return err
 	}
-	return o.send(cmdStrokeLineToPoint, data)
+	return o.sendDrawing(cmdStrokeLineToPoint, data)
 }
 
 func (o *OSD) FillRect(x int, y int, w uint, h uint) error {
@@ -106,5 +115,5 @@ func (o *OSD) FillRect(x int, y int, w uint, h uint) error {
 	data := make([]byte, 0, len(origin)+len(size))
 	data = append(data, origin...)
 	data = append(data, size...)
-	return o.send(cmdFillRect, data)
+	return o.sendDrawing(cmdFillRect, data)
 }
@@ -0,0 +1,49 @@
+package frskyosd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingConn is a connection that stores the written
+// bytes and never returns any data
+type recordingConn struct {
+	bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) { select {} }
+func (c *recordingConn) Close() error               { return nil }
+
+// testFrame returns the encoded frame for the given command
+func testFrame(cmd osdCmd, data ...byte) []byte {
+	payload := append([]byte{byte(cmd)}, data...)
+	cs := newCrc8D5Checksum()
+	cs.WriteByte(byte(len(payload)))
+	checkSumWrite(cs, payload)
+	frame := append([]byte{'$', 'A', byte(len(payload))}, payload...)
+	return append(frame, cs.Sum8())
+}
+
+func TestDrawingFrames(t *testing.T) {
+	conn := &recordingConn{}
+	o := &OSD{conn: conn}
+	o.setCapabilities(NewCapabilities(testInfo(2, 0, 0)))
+
+	cases := []struct {
+		send     func() error
+		expected []byte
+	}{
+		{func() error { return o.SetStrokeWidth(3) }, testFrame(cmdSetStrokeWidth, 3)},
+		{func() error { return o.SetStrokeColor(CWhite) }, testFrame(cmdSetStrokeColor, byte(CWhite))},
+		{func() error { return o.SetFillColor(CGray) }, testFrame(cmdSetFillColor, byte(CGray))},
+	}
+	for _, c := range cases {
+		conn.Reset()
+		if assert.NoError(t, c.send()) {
+			assert.Equal(t, c.expected, conn.Bytes())
+		}
+	}
+	assert.Error(t, o.SetStrokeColor(Color(10)))
+}
@@ -0,0 +1,261 @@
+package frskyosd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBootloader is a connection that emulates an OSD and
+// its bootloader, storing the flashed data
+type fakeBootloader struct {
+	mu         sync.Mutex
+	pending    []byte
+	out        chan byte
+	closeOnce  sync.Once
+	bootloader bool
+	flash      []byte
+	// writes counts the writes at each address
+	writes map[uint32]int
+	// write, if non-nil, handles the chunks and returns the
+	// encoded reply, nil for none. Otherwise, the chunks are
+	// stored with storeChunk.
+	write func(addr uint32, data []byte) []byte
+}
+
+func newFakeBootloader() *fakeBootloader {
+	return &fakeBootloader{
+		out:    make(chan byte, 64*1024),
+		writes: make(map[uint32]int),
+	}
+}
+
+func (b *fakeBootloader) Read(p []byte) (int, error) {
+	c, ok := <-b.out
+	if !ok {
+		return 0, io.EOF
+	}
+	p[0] = c
+	return 1, nil
+}
+
+func (b *fakeBootloader) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, p...)
+	for len(b.pending) >= 3 && len(b.pending) >= 4+int(b.pending[2]) {
+		size := int(b.pending[2])
+		payload := b.pending[3 : 3+size]
+		b.pending = b.pending[4+size:]
+		b.reply(b.handle(osdCmd(payload[0]), payload[1:]))
+	}
+	return len(p), nil
+}
+
+func (b *fakeBootloader) Close() error {
+	b.closeOnce.Do(func() { close(b.out) })
+	return nil
+}
+
+func (b *fakeBootloader) reply(frame []byte) {
+	for _, c := range frame {
+		b.out <- c
+	}
+}
+
+func (b *fakeBootloader) handle(cmd osdCmd, data []byte) []byte {
+	switch cmd {
+	case cmdInfo:
+		if b.bootloader {
+			return testFrame(cmdInfo, 'B')
+		}
+		var buf bytes.Buffer
+		buf.WriteString("AGH")
+		binary.Write(&buf, binary.LittleEndian, testInfo(2, 0, 0))
+		// Drop IsBootloader, which isn't sent
+		return testFrame(cmdInfo, buf.Bytes()[:buf.Len()-1]...)
+	case cmdReboot:
+		b.bootloader = data[0] == 1
+		return nil
+	case cmdWriteFlash:
+		addr := binary.LittleEndian.Uint32(data)
+		chunk := data[4:]
+		switch {
+		case addr == flashWriteEnd:
+			return testFlashReply(0)
+		case addr == 0 && len(chunk) == 0:
+			b.flash = nil
+			return testFlashReply(0)
+		}
+		b.writes[addr]++
+		if b.write != nil {
+			// Don't block Write while the handler runs
+			b.mu.Unlock()
+			defer b.mu.Lock()
+			return b.write(addr, chunk)
+		}
+		return b.storeChunk(addr, chunk)
+	}
+	return nil
+}
+
+// storeChunk stores the chunk and returns the reply with the
+// next address
+func (b *fakeBootloader) storeChunk(addr uint32, chunk []byte) []byte {
+	if end := int(addr) + len(chunk); end > len(b.flash) {
+		b.flash = append(b.flash, make([]byte, end-len(b.flash))...)
+	}
+	copy(b.flash[addr:], chunk)
+	return testFlashReply(addr + uint32(len(chunk)))
+}
+
+func testFlashReply(next uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, next)
+	return testFrame(cmdWriteFlash, buf...)
+}
+
+func withRebootDelay(d time.Duration) func() {
+	prev := rebootDelay
+	rebootDelay = d
+	return func() { rebootDelay = prev }
+}
+
+// testFlash flashes 200 bytes (4 chunks) to b
+func testFlash(ctx context.Context, b *fakeBootloader) ([]byte, error) {
+	o := newOSD(b)
+	defer o.Close()
+	data := make([]byte, 200)
+	for ii := range data {
+		data[ii] = byte(ii)
+	}
+	return data, o.FlashFirmwareWithOptions(ctx, bytes.NewReader(data), &FlashOptions{RetryDelay: time.Millisecond})
+}
+
+func TestFlashFirmware(t *testing.T) {
+	defer withRebootDelay(0)()
+	b := newFakeBootloader()
+	data, err := testFlash(context.Background(), b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, b.flash)
+		assert.False(t, b.bootloader)
+	}
+}
+
+func TestFlashFirmwareValidate(t *testing.T) {
+	defer withRebootDelay(0)()
+	errInvalid := errors.New("invalid firmware")
+	validate := func(data []byte) error { return errInvalid }
+	for _, force := range []bool{false, true} {
+		b := newFakeBootloader()
+		o := newOSD(b)
+		err := o.FlashFirmwareWithOptions(context.Background(), bytes.NewReader([]byte("firmware")), &FlashOptions{
+			Validate: validate,
+			Force:    force,
+		})
+		o.Close()
+		if force {
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("firmware"), b.flash)
+		} else {
+			assert.Equal(t, errInvalid, err)
+			// Rejected before rebooting into the bootloader
+			assert.False(t, b.bootloader)
+			assert.Empty(t, b.writes)
+		}
+	}
+}
+
+func TestFlashFirmwareResend(t *testing.T) {
+	defer withRebootDelay(0)()
+	b := newFakeBootloader()
+	b.bootloader = true
+	b.write = func(addr uint32, chunk []byte) []byte {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if addr == 64 && b.writes[addr] == 1 {
+			// Ask for the same chunk again
+			return testFlashReply(addr)
+		}
+		return b.storeChunk(addr, chunk)
+	}
+	data, err := testFlash(context.Background(), b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, b.flash)
+		assert.Equal(t, 2, b.writes[64])
+	}
+}
+
+func TestFlashFirmwareInvalidNext(t *testing.T) {
+	defer withRebootDelay(0)()
+	// Skipping chunks must never be accepted, not even to the end
+	for _, next := range []uint32{200, 192, 256, 0} {
+		b := newFakeBootloader()
+		b.bootloader = true
+		b.write = func(addr uint32, chunk []byte) []byte {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if addr == 64 {
+				b.storeChunk(addr, chunk)
+				return testFlashReply(next)
+			}
+			return b.storeChunk(addr, chunk)
+		}
+		_, err := testFlash(context.Background(), b)
+		if assert.Error(t, err, next) {
+			assert.Contains(t, err.Error(), "expecting next addr = 128", next)
+		}
+		assert.Equal(t, 0, b.writes[192], next)
+	}
+}
+
+func TestFlashFirmwareLastChunkError(t *testing.T) {
+	defer withRebootDelay(0)()
+	b := newFakeBootloader()
+	b.bootloader = true
+	b.write = func(addr uint32, chunk []byte) []byte {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		reply := b.storeChunk(addr, chunk)
+		if addr == 192 {
+			// Early bootloaders reply with an error
+			return testFrame(cmdError, byte(cmdWriteFlash), 0xff)
+		}
+		return reply
+	}
+	data, err := testFlash(context.Background(), b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, b.flash)
+		assert.Equal(t, 1, b.writes[192], "last chunk must not be retried")
+	}
+}
+
+func TestFlashFirmwareCancel(t *testing.T) {
+	defer withRebootDelay(0)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newFakeBootloader()
+	b.bootloader = true
+	b.write = func(addr uint32, chunk []byte) []byte {
+		if addr == 64 {
+			// Cancel while the chunk is being written
+			cancel()
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.storeChunk(addr, chunk)
+	}
+	_, err := testFlash(ctx, b)
+	assert.Equal(t, context.Canceled, err)
+	// The chunk in flight finishes, but no more are written
+	assert.Equal(t, 1, b.writes[64])
+	assert.Equal(t, 0, b.writes[128])
+	assert.True(t, b.bootloader)
+}
@@ -2,6 +2,7 @@ package frskyosd
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -9,6 +10,8 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/fiam/max7456tool/mcm"
@@ -70,6 +73,20 @@ const (
 const (
 	flashWriteMaxSize = 64
 	flashWriteEnd     = math.MaxUint32
+
+	// DefaultFlashRetries is the default number of retries
+	// for each chunk when flashing a firmware
+	DefaultFlashRetries = 5
+	// DefaultFlashRetryDelay is the default delay before the
+	// first retry when flashing a firmware
+	DefaultFlashRetryDelay = 100 * time.Millisecond
+	maxFlashRetryDelay     = 5 * time.Second
+)
+
+var (
+	// rebootDelay is the time the OSD needs to reboot. Overridden
+	// by tests.
+	rebootDelay = 3 * time.Second
 )
 
 // OSD represents a active connection to an FrSky OSD. Use
@@ -78,6 +95,8 @@ type OSD struct {
 	conn       connection
 	connCh     chan byte
 	responseCh chan *frame
+	mu         sync.Mutex
+	caps       *Capabilities
 }
 
 func (o *OSD) readConn() {
@@ -175,6 +194,7 @@ func (o *OSD) info(tryMspPassthrough bool) (*InfoMessage, error) {
 		return nil, err
 	}
 	if info, ok := msg.(*InfoMessage); ok {
+		o.setCapabilities(NewCapabilities(info))
 		return info, nil
 	}
 	return nil, &unexpectedMessageError{Expected: cmdInfo, Message: msg}
@@ -183,6 +203,9 @@ func (o *OSD) info(tryMspPassthrough bool) (*InfoMessage, error) {
 // ReadFontChar reads the character at the given index from the
 // non volatile font stored in the OSD.
 func (o *OSD) ReadFontChar(idx uint) (*FontCharMessage, error) {
+	if err := o.require(hasFonts); err != nil {
+		return nil, err
+	}
 	buf := make([]byte, 2)
 	binary.LittleEndian.PutUint16(buf, uint16(idx))
 	if err := o.send(cmdReadFont, buf); err != nil {
@@ -199,6 +222,9 @@ func (o *OSD) ReadFontChar(idx uint) (*FontCharMessage, error) {
 // to the non volatile font memory. The data must be in MCM format and be
 // either 54 (just character visible data) or 64 (visible data + metadata) bytes.
 func (o *OSD) WriteFontChar(idx uint, data []byte) error {
+	if err := o.require(hasFonts); err != nil {
+		return err
+	}
 	if len(data) != mcm.MinCharBytes && len(data) != mcm.CharBytes {
 		return fmt.Errorf("invalid char data size %d - must be %d or %d", len(data), mcm.MinCharBytes, mcm.CharBytes)
 	}
@@ -234,8 +260,30 @@ func (o *OSD) UploadFont(r io.Reader, progress func(done int, total int)) error
 	return nil
 }
 
+// UploadFontChars writes the given characters, keyed by their
+// index, to the non volatile font memory in ascending index order.
+func (o *OSD) UploadFontChars(chars map[int]*mcm.Char, progress func(done int, total int)) error {
+	indexes := make([]int, 0, len(chars))
+	for idx := range chars {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for ii, idx := range indexes {
+		if err := o.WriteFontChar(uint(idx), chars[idx].Data()); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(ii+1, len(indexes))
+		}
+	}
+	return nil
+}
+
 // ReadSettings returns the OSD settings
 func (o *OSD) ReadSettings() (*SettingsMessage, error) {
+	if err := o.require(hasSettings); err != nil {
+		return nil, err
+	}
 	buf := []byte{protocolVersion}
 	if err := o.send(cmdGetSettings, buf); err != nil {
 		return nil, err
@@ -252,6 +300,9 @@ func (o *OSD) ReadSettings() (*SettingsMessage, error) {
 // Note that the returned value might be different since
 // the OSD might not accept all the given values.
 func (o *OSD) SetSettings(settings *SettingsMessage) (*SettingsMessage, error) {
+	if err := o.require(hasSettings); err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
 	buf.WriteByte(protocolVersion)
 	if err := binary.Write(&buf, binary.LittleEndian, settings); err != nil {
@@ -274,6 +325,9 @@ func (o *OSD) SetSettings(settings *SettingsMessage) (*SettingsMessage, error) {
 // SaveSettings instructs the OSD to commit the settings to
 // non-volatile memory
 func (o *OSD) SaveSettings() error {
+	if err := o.require(hasSettings); err != nil {
+		return err
+	}
 	if err := o.send(cmdSaveSettings, nil); err != nil {
 		return err
 	}
@@ -291,6 +345,9 @@ func (o *OSD) SaveSettings() error {
 // camera. If no camera is detected, the return value will be
 // <= 0. Valid camera indexes start at 1.
 func (o *OSD) ActiveCamera() (int, error) {
+	if err := o.require(hasSettings); err != nil {
+		return -1, err
+	}
 	if err := o.send(cmdGetActiveCamera, nil); err != nil {
 		return -1, err
 	}
@@ -305,10 +362,148 @@ func (o *OSD) ActiveCamera() (int, error) {
 	return int(rmsg.Payload[0]), nil
 }
 
+// FlashPhase indicates the step being performed while flashing
+type FlashPhase int
+
+const (
+	// FlashPhaseBootloader is the reboot into bootloader mode
+	FlashPhaseBootloader FlashPhase = iota + 1
+	// FlashPhaseErase is the flash erase performed by the bootloader
+	FlashPhaseErase
+	// FlashPhaseWrite is the transfer of the firmware data
+	FlashPhaseWrite
+	// FlashPhaseVerify is the firmware verification performed by
+	// the bootloader after all the data has been written
+	FlashPhaseVerify
+	// FlashPhaseReboot is the reboot into the new firmware
+	FlashPhaseReboot
+)
+
+func (p FlashPhase) String() string {
+	switch p {
+	case FlashPhaseBootloader:
+		return "Rebooting into bootloader"
+	case FlashPhaseErase:
+		return "Erasing"
+	case FlashPhaseWrite:
+		return "Writing"
+	case FlashPhaseVerify:
+		return "Verifying"
+	case FlashPhaseReboot:
+		return "Rebooting"
+	}
+	return fmt.Sprintf("unknown %T = %d", p, int(p))
+}
+
+// FlashProgress is reported while flashing a firmware
+type FlashProgress struct {
+	Phase FlashPhase
+	// Done is the number of bytes written so far
+	Done int
+	// Total is the total number of bytes to write
+	Total int
+	// Rate is the write speed in bytes per second, zero
+	// if still unknown
+	Rate float64
+	// ETA is the estimated remaining time for the write
+	// phase, zero if still unknown
+	ETA time.Duration
+}
+
+// Fraction returns the fraction of bytes written, between 0 and 1
+func (p *FlashProgress) Fraction() float64 {
+	if p.Total == 0 {
+		if p.Phase > FlashPhaseWrite {
+			return 1
+		}
+		return 0
+	}
+	return float64(p.Done) / float64(p.Total)
+}
+
+func (p *FlashProgress) String() string {
+	if p.Phase != FlashPhaseWrite {
+		return p.Phase.String() + "..."
+	}
+	s := fmt.Sprintf("%s %d/%d bytes", p.Phase, p.Done, p.Total)
+	if p.Rate > 0 {
+		s += fmt.Sprintf(", %.1f KiB/s, %v left", p.Rate/1024, p.ETA.Round(time.Second))
+	}
+	return s
+}
+
+// FlashOptions contains the options for FlashFirmwareWithOptions
+type FlashOptions struct {
+	// Validate, if non-nil, checks the firmware before the OSD
+	// is rebooted into the bootloader. Firmwares it rejects
+	// aren't flashed, unless Force is true.
+	Validate func(data []byte) error
+	// Force flashes firmwares rejected by Validate
+	Force bool
+	// Progress, if non-nil, is called when the phase changes
+	// and after each chunk is written
+	Progress func(p *FlashProgress)
+	// Retries is the number of times each chunk is retried
+	// before giving up. Zero means DefaultFlashRetries, while
+	// a negative value disables retries.
+	Retries int
+	// RetryDelay is the delay before the first retry, doubled
+	// for each subsequent one. Zero means DefaultFlashRetryDelay.
+	RetryDelay time.Duration
+}
+
+func (opts *FlashOptions) retries() int {
+	if opts.Retries == 0 {
+		return DefaultFlashRetries
+	}
+	if opts.Retries < 0 {
+		return 0
+	}
+	return opts.Retries
+}
+
+func (opts *FlashOptions) retryDelay(attempt int) time.Duration {
+	d := opts.RetryDelay
+	if d == 0 {
+		d = DefaultFlashRetryDelay
+	}
+	d <<= uint(attempt)
+	if d > maxFlashRetryDelay {
+		d = maxFlashRetryDelay
+	}
+	return d
+}
+
 // FlashFirmware flashes the given firmware to the OSD. The data must be
 // an FrSky supplied firmware file. Alternatively, a nil io.Reader can be
-// passsed to erase the whole firmware and leave only the bootloader.
+// passsed to erase the whole firmware and leave only the bootloader, in
+// which case the OSD stays in bootloader mode. The data is not validated,
+// use FlashFirmwareWithOptions with a Validate function to check it.
+//
+// If the OSD is already in bootloader mode (e.g. because a previous
+// flash was interrupted), the reboot into the bootloader is skipped,
+// so this can also be used to resume a failed flash.
 func (o *OSD) FlashFirmware(r io.Reader, progress func(done int, total int)) error {
+	opts := &FlashOptions{}
+	if progress != nil {
+		opts.Progress = func(p *FlashProgress) {
+			if p.Phase == FlashPhaseWrite {
+				progress(p.Done, p.Total)
+			}
+		}
+	}
+	return o.FlashFirmwareWithOptions(context.Background(), r, opts)
+}
+
+// FlashFirmwareWithOptions works like FlashFirmware, but allows
+// specifying the options. If ctx is cancelled, flashing stops
+// before writing the next chunk and ctx.Err() is returned. In
+// that case, the OSD is left in bootloader mode and flashing
+// can be resumed by calling this function again.
+func (o *OSD) FlashFirmwareWithOptions(ctx context.Context, r io.Reader, opts *FlashOptions) error {
+	if opts == nil {
+		opts = &FlashOptions{}
+	}
 	var data []byte
 	var err error
 	if r != nil {
@@ -316,62 +511,103 @@ func (o *OSD) FlashFirmware(r io.Reader, progress func(done int, total int)) err
 		if err != nil {
 			return err
 		}
+		if opts.Validate != nil && !opts.Force {
+			if err := opts.Validate(data); err != nil {
+				return err
+			}
+		}
 	}
-	if err := o.reboot(true); err != nil {
-		return err
+	total := uint32(len(data))
+	progress := &FlashProgress{Total: len(data)}
+	setPhase := func(phase FlashPhase) {
+		progress.Phase = phase
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
 	}
-	time.Sleep(3 * time.Second)
-	info, err := o.Info()
-	if err != nil {
+	setPhase(FlashPhaseBootloader)
+	if err := o.enterBootloader(); err != nil {
 		return err
 	}
-	if !info.IsBootloader {
-		return errors.New("failed to reboot into bootloader mode")
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	setPhase(FlashPhaseErase)
 	if err := o.flashBegin(); err != nil {
 		return err
 	}
-	rem := data
+	setPhase(FlashPhaseWrite)
+	writeStarted := time.Now()
 	addr := uint32(0)
-	for len(rem) > 0 {
-		n := len(rem)
+	stalled := 0
+	for addr < total {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := total - addr
 		if n > flashWriteMaxSize {
 			n = flashWriteMaxSize
 		}
-		chunk := rem[:n]
-		rem = rem[n:]
-		next, err := o.flashChunk(addr, chunk)
+		chunk := data[addr : addr+n]
+		retries := opts.retries()
+		if earlyBootloaderWorkaround && addr+n == total {
+			// Early bootloaders reply to the last chunk with an
+			// error, handled below. Retrying would just delay it.
+			retries = 0
+		}
+		next, err := o.flashChunkWithRetries(addr, chunk, retries, opts)
 		if err != nil {
 			if earlyBootloaderWorkaround {
-				if len(rem) == 0 {
+				if addr+n == total {
 					if ue, ok := err.(*unexpectedMessageError); ok {
 						if em, ok := ue.Message.(*ErrorMessage); ok && em.Cmd == cmdWriteFlash {
-							next = addr + uint32(n)
+							next = addr + n
+							err = nil
 						}
 					}
 				}
 			}
-			if next == 0 {
+			if err != nil {
 				return err
 			}
 		}
-		addr += uint32(n)
-		if next != addr {
-			return fmt.Errorf("expecting next addr = %d, got %d instead", addr, next)
+		if next != addr+n {
+			// The bootloader tells us the address it expects next.
+			// The only valid one besides addr+n is addr, which means
+			// the chunk wasn't stored and must be sent again.
+			if next != addr || stalled >= opts.retries() {
+				return fmt.Errorf("expecting next addr = %d, got %d instead", addr+n, next)
+			}
+			log.Warnf("flash: bootloader requested the chunk at %d again", addr)
 		}
-		if progress != nil {
-			progress(int(addr), len(data))
+		if next == addr {
+			stalled++
+		} else {
+			stalled = 0
+		}
+		addr = next
+		progress.Done = int(addr)
+		if elapsed := time.Since(writeStarted); elapsed > 0 && addr > 0 {
+			progress.Rate = float64(addr) / elapsed.Seconds()
+			progress.ETA = time.Duration(float64(total-addr) / progress.Rate * float64(time.Second))
 		}
+		setPhase(FlashPhaseWrite)
 	}
+	setPhase(FlashPhaseVerify)
 	if err := o.flashEnd(); err != nil {
 		return err
 	}
-	time.Sleep(3 * time.Second)
+	if data == nil {
+		// Firmware was erased, stay in the bootloader
+		return nil
+	}
+	setPhase(FlashPhaseReboot)
+	time.Sleep(rebootDelay)
 	if err := o.reboot(false); err != nil {
 		return err
 	}
-	time.Sleep(3 * time.Second)
-	info, err = o.Info()
+	time.Sleep(rebootDelay)
+	info, err := o.Info()
 	if err != nil {
 		return err
 	}
@@ -381,6 +617,63 @@ func (o *OSD) FlashFirmware(r io.Reader, progress func(done int, total int)) err
 	return nil
 }
 
+// enterBootloader reboots the OSD into bootloader mode, unless
+// it's already running the bootloader.
+func (o *OSD) enterBootloader() error {
+	if info, err := o.Info(); err == nil && info.IsBootloader {
+		log.Infof("OSD is already in bootloader mode")
+		return nil
+	}
+	if err := o.reboot(true); err != nil {
+		return err
+	}
+	time.Sleep(rebootDelay)
+	info, err := o.Info()
+	if err != nil {
+		return err
+	}
+	if !info.IsBootloader {
+		return errors.New("failed to reboot into bootloader mode")
+	}
+	return nil
+}
+
+// flashChunkWithRetries writes a chunk, retrying up to the given
+// number of times with an exponential backoff if there's no reply
+// or an unexpected one.
+func (o *OSD) flashChunkWithRetries(addr uint32, data []byte, retries int, opts *FlashOptions) (uint32, error) {
+	for attempt := 0; ; attempt++ {
+		next, err := o.flashChunk(addr, data)
+		if err == nil || attempt >= retries {
+			return next, err
+		}
+		if _, ok := err.(*unexpectedMessageError); !ok && err != ErrTimeout {
+			return next, err
+		}
+		delay := opts.retryDelay(attempt)
+		log.Warnf("flash: error writing %d bytes at %d (%v), retrying in %v (%d/%d)",
+			len(data), addr, err, delay, attempt+1, retries)
+		time.Sleep(delay)
+		o.discardResponses()
+	}
+}
+
+// discardResponses drops any pending responses, which might
+// be late replies to a request that timed out.
+func (o *OSD) discardResponses() {
+	for {
+		select {
+		case resp := <-o.responseCh:
+			if resp == nil {
+				return
+			}
+			log.Debugf("discarding response %+v", resp)
+		default:
+			return
+		}
+	}
+}
+
 // Close closes the connection to the OSD
 func (o *OSD) Close() error {
 	return o.conn.Close()
@@ -446,6 +739,11 @@ func New(port string) (*OSD, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newOSD(c), nil
+}
+
+// newOSD starts decoding the responses from the given connection
+func newOSD(c connection) *OSD {
 	osd := &OSD{
 		conn:       c,
 		connCh:     make(chan byte, 512),
@@ -453,5 +751,5 @@ func New(port string) (*OSD, error) {
 	}
 	go osd.readConn()
 	go osd.decodeResponses()
-	return osd, nil
+	return osd
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+
+	"osdapp/internal/osdversion"
 )
 
 // TVStandard indicates the type of the analog TV signal
@@ -63,6 +65,12 @@ type InfoMessage struct {
 	IsBootloader      bool
 }
 
+// FirmwareVersion returns the version of the firmware running
+// in the OSD. Note that it's zero in bootloader mode.
+func (m *InfoMessage) FirmwareVersion() osdversion.Version {
+	return osdversion.New(int(m.Version.Major), int(m.Version.Minor), int(m.Version.Patch))
+}
+
 func (m *InfoMessage) frameType() frameType { return frameTypeOSD }
 func (m *InfoMessage) decode(cmd int, payload []byte) error {
 	if len(payload) == 1 && payload[0] == 'B' {
@@ -6,7 +6,6 @@ require (
 	fyne.io/fyne v1.2.3
 	github.com/fiam/max7456tool v0.7.2
 	github.com/go-daq/crc8 v0.0.0-20170116120732-380c22547098
-	github.com/google/go-github v17.0.0+incompatible
 	github.com/google/go-github/v30 v30.0.0
 	github.com/gotk3/gotk3 v0.4.0 // indirect
 	github.com/hashicorp/go-version v1.2.0
@@ -18,6 +17,5 @@ require (
 	github.com/stretchr/testify v1.4.0
 	go.bug.st/serial v1.0.0
 	golang.org/x/net v0.0.0-20200301022130-244492dfa37a // indirect
-	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
@@ -0,0 +1,39 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "a", "b", "file.json")
+	for _, data := range []string{"first", "second"} {
+		if assert.NoError(t, WriteFile(p, []byte(data), 0644)) {
+			read, err := ioutil.ReadFile(p)
+			assert.NoError(t, err)
+			assert.Equal(t, data, string(read))
+		}
+	}
+	if runtime.GOOS != "windows" {
+		st, err := os.Stat(p)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0644), st.Mode().Perm())
+		}
+	}
+	// No temporary files should be left behind
+	entries, err := ioutil.ReadDir(filepath.Dir(p))
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "file.json", entries[0].Name())
+	}
+}
@@ -0,0 +1,62 @@
+package autoupdater
+
+import (
+	"strings"
+)
+
+const (
+	tarGzExtension = ".tar.gz"
+	zipExtension   = ".zip"
+)
+
+// assetPlatform describes how the release assets for
+// a given platform are named
+type assetPlatform struct {
+	// Tag is the platform part of the asset name,
+	// surrounded by dashes
+	Tag       string
+	Extension string
+}
+
+// platformForAsset returns the naming scheme used by the dist
+// targets in the Makefile for the given platform:
+//
+//	App_Name-linux-<goarch>-<version>.tar.gz
+//	App_Name-win32-<version>.zip
+//	App_Name-win64-<version>.zip
+//	App_Name-macOS-<version>.zip
+//
+// It returns nil if there are no builds for the platform.
+func platformForAsset(goos string, goarch string) *assetPlatform {
+	switch goos {
+	case "linux":
+		return &assetPlatform{Tag: "-linux-" + goarch + "-", Extension: tarGzExtension}
+	case "windows":
+		switch goarch {
+		case "386":
+			return &assetPlatform{Tag: "-win32-", Extension: zipExtension}
+		case "amd64":
+			return &assetPlatform{Tag: "-win64-", Extension: zipExtension}
+		}
+	case "darwin":
+		// Single build for all the supported architectures
+		return &assetPlatform{Tag: "-macos-", Extension: zipExtension}
+	}
+	return nil
+}
+
+// matchAsset returns the asset for the given platform, or nil if
+// there's none. See platformForAsset for the supported names.
+func matchAsset(assets []*Asset, goos string, goarch string) *Asset {
+	p := platformForAsset(goos, goarch)
+	if p == nil {
+		return nil
+	}
+	for _, a := range assets {
+		name := strings.ToLower(a.Name)
+		if strings.Contains(name, p.Tag) && strings.HasSuffix(name, p.Extension) {
+			return a
+		}
+	}
+	return nil
+}
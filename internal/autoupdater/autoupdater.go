@@ -4,26 +4,47 @@ import (
 	"context"
 	"errors"
 	"log"
-	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-version"
-	"github.com/pkg/browser"
 )
 
 type Options struct {
 	// Version overrides the app version returned automatically
-	Version         string
+	Version string
+	// AcceptPreleases makes prereleases eligible as updates.
+	// See also AutoUpdater.SetAcceptPrereleases.
 	AcceptPreleases bool
 	// NoSkipRelease disables the "Skip this release" option
 	NoSkipRelease bool
 	Source        Source
 	Dialog        Dialog
+	// Store persists the skipped release. If nil, skipped
+	// releases are forgotten when the app exits.
+	Store Store
+	// DownloadDir is the directory where downloaded releases are
+	// saved. If empty, the user's Downloads directory is used.
+	DownloadDir string
 }
 
+const (
+	// maxPages is the maximum number of pages retrieved
+	// from a Source while looking for the newest release
+	maxPages = 10
+)
+
 type AutoUpdater struct {
-	opts *Options
+	mu    sync.Mutex
+	opts  *Options
+	store Store
+	// checking serializes CheckForUpdates, so a check started
+	// while another one is in progress can't show a second dialog
+	checking sync.Mutex
+	// executable overrides the path of the executable
+	// replaced when installing updates
+	executable string
 }
 
 // New returns a new AutoUpdater. See the Options
@@ -35,8 +56,15 @@ func New(opts *Options) (*AutoUpdater, error) {
 	if opts == nil || opts.Dialog == nil {
 		panic(errors.New("Dialog cannot be nil"))
 	}
+	store := opts.Store
+	if store == nil {
+		store = &memoryStore{}
+	}
+	// Copy the options, since some of them can be changed
+	o := *opts
 	return &AutoUpdater{
-		opts: opts,
+		opts:  &o,
+		store: store,
 	}, nil
 }
 
@@ -44,52 +72,70 @@ func (au *AutoUpdater) currentVersion() (string, error) {
 	return au.opts.Version, nil
 }
 
-func (au *AutoUpdater) CheckForUpdates(ctx context.Context) error {
-	var allReleases []*Release
-	var releases []*Release
-	var next string
-	var err error
-	for {
-		releases, next, err = au.opts.Source.AvailableVersions(ctx, next)
+// SetAcceptPrereleases changes whether prereleases are offered as
+// updates, e.g. when the user switches to the beta channel. It takes
+// effect on the next check.
+func (au *AutoUpdater) SetAcceptPrereleases(accept bool) {
+	au.mu.Lock()
+	au.opts.AcceptPreleases = accept
+	au.mu.Unlock()
+}
+
+func (au *AutoUpdater) acceptsPrereleases() bool {
+	au.mu.Lock()
+	defer au.mu.Unlock()
+	return au.opts.AcceptPreleases
+}
+
+// newestRelease returns the newest release accepted by the current
+// channel, or nil if there are none. Sources return newer releases
+// first, so pages are only retrieved until one of them contains an
+// acceptable release.
+func (au *AutoUpdater) newestRelease(ctx context.Context) (*Release, *version.Version, error) {
+	acceptPrereleases := au.acceptsPrereleases()
+	var newest *Release
+	var newestVersion *version.Version
+	seen := make(map[string]bool)
+	var token string
+	for page := 0; page < maxPages; page++ {
+		releases, next, err := au.opts.Source.AvailableVersions(ctx, token)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		foundNonPrerelease := false
 		for _, r := range releases {
-			if !r.IsPrerelease {
-				foundNonPrerelease = true
+			v, err := version.NewVersion(r.Version)
+			if err != nil {
+				log.Printf("ignoring release with invalid version %q: %v", r.Version, err)
+				continue
+			}
+			if !acceptPrereleases && (r.IsPrerelease || v.Prerelease() != "") {
+				continue
+			}
+			if newestVersion == nil || v.GreaterThan(newestVersion) {
+				newest = r
+				newestVersion = v
 			}
-			allReleases = append(allReleases, r)
-		}
-		if foundNonPrerelease {
-			break
 		}
-		if next == "" {
+		if newest != nil || next == "" || seen[next] {
 			break
 		}
+		seen[next] = true
+		token = next
 	}
-	if !au.opts.AcceptPreleases {
-		var nonPrereleases []*Release
-		for _, r := range allReleases {
-			if !r.IsPrerelease {
-				nonPrereleases = append(nonPrereleases, r)
-			}
-		}
-		allReleases = nonPrereleases
+	return newest, newestVersion, nil
+}
+
+func (au *AutoUpdater) CheckForUpdates(ctx context.Context) error {
+	au.checking.Lock()
+	defer au.checking.Unlock()
+	newestRelease, nv, err := au.newestRelease(ctx)
+	if err != nil {
+		return err
 	}
-	if len(allReleases) == 0 {
+	if newestRelease == nil {
 		// No updates found
 		return nil
 	}
-	sort.Slice(allReleases, func(i, j int) bool {
-		ri := allReleases[i]
-		rj := allReleases[j]
-		vi := version.Must(version.NewVersion(ri.Version))
-		vj := version.Must(version.NewVersion(rj.Version))
-
-		return vi.GreaterThan(vj)
-	})
-	newestRelease := allReleases[0]
 	currentVersion, err := au.currentVersion()
 	if err != nil {
 		return err
@@ -98,15 +144,18 @@ func (au *AutoUpdater) CheckForUpdates(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	nv, err := version.NewVersion(newestRelease.Version)
-	if err != nil {
-		return err
-	}
 	if nv.LessThanOrEqual(cv) {
 		// Latest update is the version we're already
 		// running
 		return nil
 	}
+	skipped, err := au.isSkipped(nv)
+	if err != nil {
+		return err
+	}
+	if skipped {
+		return nil
+	}
 	var responses []DialogResponse
 	if au.opts.NoSkipRelease {
 		responses = append(responses, DialogResponseCancel)
@@ -114,25 +163,29 @@ func (au *AutoUpdater) CheckForUpdates(ctx context.Context) error {
 		responses = append(responses, DialogResponseSkipRelease)
 	}
 	responses = append(responses, DialogResponseRemindLater)
-	if au.canInstallUpdates() {
+	if au.canInstallUpdates(newestRelease) {
 		responses = append(responses, DialogResponseDownloadAndInstall)
 	} else {
 		responses = append(responses, DialogResponseDownload)
 	}
-	var resp DialogResponse
-	var wg sync.WaitGroup
-	wg.Add(1)
+	// Buffered, so a response arriving after ctx is done
+	// doesn't block the dialog
+	done := make(chan DialogResponse, 1)
 	opts := &DialogOptions{
 		CurrentVersion:   currentVersion,
 		AvailableRelease: newestRelease,
 		Responses:        responses,
 		Response: func(r DialogResponse) {
-			defer wg.Done()
-			resp = r
+			done <- r
 		},
 	}
 	go au.opts.Dialog.ShowUpdaterDialog(opts)
-	wg.Wait()
+	var resp DialogResponse
+	select {
+	case resp = <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	switch resp {
 	case DialogResponseCancel:
 		return nil
@@ -142,29 +195,95 @@ func (au *AutoUpdater) CheckForUpdates(ctx context.Context) error {
 		// Nothing to do, we'll remind on next check
 		return nil
 	case DialogResponseDownload:
-		return browser.OpenURL(opts.AvailableRelease.URL)
+		return au.download(ctx, opts.AvailableRelease)
 	case DialogResponseDownloadAndInstall:
-		// TODO
+		return au.downloadAndInstall(ctx, opts.AvailableRelease)
 	}
 	return nil
 }
 
 func (au *AutoUpdater) skipRelease(rel *Release) error {
-	// TODO: Skip
-	return nil
+	return au.store.Save(skippedVersionKey, rel.Version)
+}
+
+// isSkipped returns true iff the user skipped the release with
+// version v or a newer one.
+func (au *AutoUpdater) isSkipped(v *version.Version) (bool, error) {
+	skipped, err := au.store.Load(skippedVersionKey)
+	if err != nil || skipped == "" {
+		return false, err
+	}
+	sv, err := version.NewVersion(skipped)
+	if err != nil {
+		log.Printf("ignoring invalid skipped version %q: %v", skipped, err)
+		return false, nil
+	}
+	return v.LessThanOrEqual(sv), nil
 }
 
-// ScheduleCheckingForUpdates checks for updates once, then starts
-// checking again indefinitely at the given interval.
-func (au *AutoUpdater) ScheduleCheckingForUpdates(interval time.Duration) {
-	doCheck := func() {
-		ctx := context.Background()
-		if err := au.CheckForUpdates(ctx); err != nil {
+// ScheduleCheckingForUpdates checks for updates every interval until
+// ctx is cancelled. The time of the last check is persisted in the
+// Store, so restarting the app doesn't trigger a new check until the
+// interval has elapsed. If the Source is rate limited, checks are
+// postponed until the limit resets.
+func (au *AutoUpdater) ScheduleCheckingForUpdates(ctx context.Context, interval time.Duration) {
+	for {
+		timer := time.NewTimer(au.nextCheckDelay(interval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := au.CheckForUpdates(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if rle, ok := err.(*RateLimitError); ok {
+			log.Printf("checking for updates: %v", rle)
+			au.saveTime(rateLimitResetKey, rle.Reset)
+			continue
+		}
+		if err != nil {
 			log.Printf("error checking for updates: %v", err)
 		}
+		au.saveTime(lastCheckKey, time.Now())
+	}
+}
+
+// nextCheckDelay returns how long to wait until the next check,
+// taking into account the last one and the rate limits
+func (au *AutoUpdater) nextCheckDelay(interval time.Duration) time.Duration {
+	now := time.Now()
+	next := now
+	if last, ok := au.loadTime(lastCheckKey); ok && last.Before(now) {
+		next = last.Add(interval)
 	}
-	go doCheck()
-	for range time.Tick(interval) {
-		doCheck()
+	if reset, ok := au.loadTime(rateLimitResetKey); ok && reset.After(next) {
+		next = reset
+	}
+	if next.Before(now) {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// loadTime returns the time stored with the given key, as
+// seconds since the epoch
+func (au *AutoUpdater) loadTime(key string) (time.Time, bool) {
+	s, err := au.store.Load(key)
+	if err != nil || s == "" {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(n, 0), true
+}
+
+func (au *AutoUpdater) saveTime(key string, t time.Time) {
+	if err := au.store.Save(key, strconv.FormatInt(t.Unix(), 10)); err != nil {
+		log.Printf("error saving %s: %v", key, err)
 	}
 }
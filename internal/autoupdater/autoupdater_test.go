@@ -0,0 +1,283 @@
+package autoupdater
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	releases []*Release
+}
+
+func (s *fakeSource) AvailableVersions(ctx context.Context, token string) ([]*Release, string, error) {
+	return s.releases, "", nil
+}
+
+type fakeDialog struct {
+	response  DialogResponse
+	shown     []*DialogOptions
+	restarted []*RestartDialogOptions
+}
+
+func (d *fakeDialog) ShowUpdaterDialog(opts *DialogOptions) {
+	d.shown = append(d.shown, opts)
+	opts.Response(d.response)
+}
+
+func (d *fakeDialog) ShowRestartDialog(opts *RestartDialogOptions) {
+	d.restarted = append(d.restarted, opts)
+	opts.Response(false)
+}
+
+func testAutoUpdater(t *testing.T, src Source, dlg Dialog, store Store) *AutoUpdater {
+	au, err := New(&Options{
+		Version: "1.0.0",
+		Source:  src,
+		Dialog:  dlg,
+		Store:   store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return au
+}
+
+func TestSkipRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoupdater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storePath := filepath.Join(dir, "state", "autoupdater.json")
+
+	src := &fakeSource{releases: []*Release{{Version: "1.1.0"}}}
+	dlg := &fakeDialog{response: DialogResponseSkipRelease}
+	ctx := context.Background()
+
+	au := testAutoUpdater(t, src, dlg, NewFileStore(storePath))
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 1) {
+		assert.Equal(t, "1.1.0", dlg.shown[0].AvailableRelease.Version)
+		assert.True(t, dlg.shown[0].AllowsResponse(DialogResponseSkipRelease))
+	}
+
+	// Skipped release must not be offered again, even after a restart
+	au = testAutoUpdater(t, src, dlg, NewFileStore(storePath))
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	assert.Len(t, dlg.shown, 1)
+
+	// Newer releases are still offered
+	src.releases = append(src.releases, &Release{Version: "1.2.0"})
+	dlg.response = DialogResponseRemindLater
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 2) {
+		assert.Equal(t, "1.2.0", dlg.shown[1].AvailableRelease.Version)
+	}
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	assert.Len(t, dlg.shown, 3)
+}
+
+func TestSkipReleaseWithoutStore(t *testing.T) {
+	src := &fakeSource{releases: []*Release{{Version: "1.1.0"}}}
+	dlg := &fakeDialog{response: DialogResponseSkipRelease}
+	ctx := context.Background()
+
+	au := testAutoUpdater(t, src, dlg, nil)
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	assert.Len(t, dlg.shown, 1)
+}
+
+func TestNoUpdate(t *testing.T) {
+	src := &fakeSource{releases: []*Release{{Version: "1.0.0"}, {Version: "1.1.0", IsPrerelease: true}}}
+	dlg := &fakeDialog{response: DialogResponseCancel}
+
+	au := testAutoUpdater(t, src, dlg, nil)
+	assert.NoError(t, au.CheckForUpdates(context.Background()))
+	assert.Len(t, dlg.shown, 0)
+}
+
+// blockingDialog keeps the updater dialog open until release
+// is closed
+type blockingDialog struct {
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+	shown   int
+	release chan struct{}
+}
+
+func (d *blockingDialog) ShowUpdaterDialog(opts *DialogOptions) {
+	d.mu.Lock()
+	d.open++
+	d.shown++
+	if d.open > d.maxOpen {
+		d.maxOpen = d.open
+	}
+	d.mu.Unlock()
+	<-d.release
+	d.mu.Lock()
+	d.open--
+	d.mu.Unlock()
+	opts.Response(DialogResponseRemindLater)
+}
+
+func (d *blockingDialog) ShowRestartDialog(opts *RestartDialogOptions) {
+	opts.Response(false)
+}
+
+func (d *blockingDialog) Shown() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.shown
+}
+
+func TestConcurrentChecks(t *testing.T) {
+	src := &fakeSource{releases: []*Release{{Version: "1.1.0"}}}
+	dlg := &blockingDialog{release: make(chan struct{})}
+	au := testAutoUpdater(t, src, dlg, nil)
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < 2; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, au.CheckForUpdates(context.Background()))
+		}()
+	}
+	for dlg.Shown() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The second check must wait for the first dialog to close
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, dlg.Shown())
+	close(dlg.release)
+	wg.Wait()
+	assert.Equal(t, 2, dlg.Shown())
+	assert.Equal(t, 1, dlg.maxOpen)
+}
+
+func TestCheckForUpdatesCancel(t *testing.T) {
+	src := &fakeSource{releases: []*Release{{Version: "1.1.0"}}}
+	dlg := &blockingDialog{release: make(chan struct{})}
+	defer close(dlg.release)
+	au := testAutoUpdater(t, src, dlg, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- au.CheckForUpdates(ctx)
+	}()
+	for dlg.Shown() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-errs:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("CheckForUpdates didn't return after cancelling its context")
+	}
+}
+
+// pagedSource returns a page of releases for each token,
+// which is the page index
+type pagedSource struct {
+	pages   [][]*Release
+	fetched int
+	loop    bool
+}
+
+func (s *pagedSource) AvailableVersions(ctx context.Context, token string) ([]*Release, string, error) {
+	page := 0
+	if token != "" {
+		page, _ = strconv.Atoi(token)
+	}
+	s.fetched++
+	next := ""
+	if page+1 < len(s.pages) {
+		next = strconv.Itoa(page + 1)
+	} else if s.loop {
+		next = "0"
+	}
+	return s.pages[page], next, nil
+}
+
+func TestChannels(t *testing.T) {
+	src := &pagedSource{pages: [][]*Release{
+		{{Version: "2.1.0-beta.2", IsPrerelease: true}, {Version: "2.1.0-rc.1"}},
+		{{Version: "2.0.3"}, {Version: "2.0.4"}},
+		{{Version: "2.0.2"}},
+	}}
+	dlg := &fakeDialog{response: DialogResponseRemindLater}
+	au := testAutoUpdater(t, src, dlg, nil)
+	ctx := context.Background()
+
+	// Stable channel must skip the prereleases, including the
+	// ones not flagged as such, and stop once it finds a release
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 1) {
+		assert.Equal(t, "2.0.4", dlg.shown[0].AvailableRelease.Version)
+	}
+	assert.Equal(t, 2, src.fetched)
+
+	src.fetched = 0
+	au.SetAcceptPrereleases(true)
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 2) {
+		assert.Equal(t, "2.1.0-rc.1", dlg.shown[1].AvailableRelease.Version)
+	}
+	assert.Equal(t, 1, src.fetched)
+}
+
+func TestPrereleaseOrdering(t *testing.T) {
+	src := &fakeSource{releases: []*Release{
+		{Version: "2.1.0-beta.9", IsPrerelease: true},
+		{Version: "2.1.0-beta.10", IsPrerelease: true},
+		{Version: "2.0.9"},
+	}}
+	dlg := &fakeDialog{response: DialogResponseRemindLater}
+	au, err := New(&Options{Version: "2.1.0-beta.2", AcceptPreleases: true, Source: src, Dialog: dlg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 1) {
+		assert.Equal(t, "2.1.0-beta.10", dlg.shown[0].AvailableRelease.Version)
+	}
+
+	// Final release is newer than all its betas
+	src.releases = append(src.releases, &Release{Version: "2.1.0"})
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 2) {
+		assert.Equal(t, "2.1.0", dlg.shown[1].AvailableRelease.Version)
+	}
+
+	// Users running a beta on the stable channel get the final release
+	au.SetAcceptPrereleases(false)
+	assert.NoError(t, au.CheckForUpdates(ctx))
+	if assert.Len(t, dlg.shown, 3) {
+		assert.Equal(t, "2.1.0", dlg.shown[2].AvailableRelease.Version)
+	}
+}
+
+func TestPagingStops(t *testing.T) {
+	src := &pagedSource{pages: [][]*Release{
+		{{Version: "2.1.0-beta.1", IsPrerelease: true}},
+		{{Version: "2.1.0-beta.2", IsPrerelease: true}},
+	}, loop: true}
+	dlg := &fakeDialog{response: DialogResponseRemindLater}
+	au := testAutoUpdater(t, src, dlg, nil)
+	assert.NoError(t, au.CheckForUpdates(context.Background()))
+	assert.Len(t, dlg.shown, 0)
+	assert.True(t, src.fetched <= maxPages, "fetched %d pages", src.fetched)
+}
@@ -44,6 +44,17 @@ func (r DialogResponse) String() string {
 	return fmt.Sprintf("unknown %T = %d", r, int(r))
 }
 
+// RestartDialogOptions are passed to Dialog.ShowRestartDialog after
+// an update has been installed
+type RestartDialogOptions struct {
+	// Version is the version that was installed
+	Version string
+	// Response must be called with true to restart the
+	// app immediately or false to restart it later
+	Response func(restart bool)
+}
+
 type Dialog interface {
 	ShowUpdaterDialog(opts *DialogOptions)
+	ShowRestartDialog(opts *RestartDialogOptions)
 }
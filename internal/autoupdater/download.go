@@ -0,0 +1,59 @@
+package autoupdater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/browser"
+)
+
+var (
+	// Overridden in tests
+	openURL  = browser.OpenURL
+	openFile = browser.OpenFile
+)
+
+// downloadsDir returns the directory where downloaded releases
+// are saved
+func (au *AutoUpdater) downloadsDir() (string, error) {
+	if au.opts.DownloadDir != "" {
+		return au.opts.DownloadDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, "Downloads")
+	if st, err := os.Stat(dir); err == nil && st.IsDir() {
+		return dir, nil
+	}
+	return home, nil
+}
+
+// download saves the asset for the current platform into the
+// downloads directory and opens it. If the release has no asset
+// for the current platform, its web page is opened instead.
+func (au *AutoUpdater) download(ctx context.Context, rel *Release) error {
+	asset := au.platformAsset(rel)
+	if asset == nil {
+		return openURL(rel.URL)
+	}
+	dir, err := au.downloadsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := au.downloadAsset(ctx, rel, asset, dir)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(dir, filepath.Base(asset.Name))
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return openFile(dir)
+}
@@ -0,0 +1,90 @@
+package autoupdater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownload(t *testing.T) {
+	p := platformForAsset(runtime.GOOS, runtime.GOARCH)
+	if p == nil {
+		t.Skip("no releases for this platform")
+	}
+	dir, err := ioutil.TempDir("", "autoupdater-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	assetName := "FrSky_OSD" + p.Tag + "1.1.0" + p.Extension
+	data := []byte("release")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(data)
+		case "/" + checksumsFile:
+			fmt.Fprintf(w, "%s  %s\n", sha256Hex(data), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var opened []string
+	defer func(f func(string) error) { openFile = f }(openFile)
+	openFile = func(p string) error {
+		opened = append(opened, p)
+		return nil
+	}
+
+	rel := &Release{
+		Version: "1.1.0",
+		Assets: []*Asset{
+			{Name: "FrSky_OSD-other-1.1.0.zip", URL: srv.URL + "/other"},
+			{Name: assetName, URL: srv.URL + "/" + assetName},
+			{Name: checksumsFile, URL: srv.URL + "/" + checksumsFile},
+		},
+	}
+	au, err := New(&Options{
+		Version:     "1.0.0",
+		Source:      &fakeSource{releases: []*Release{rel}},
+		Dialog:      &fakeDialog{response: DialogResponseDownload},
+		DownloadDir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, au.CheckForUpdates(context.Background()))
+	downloaded, err := ioutil.ReadFile(filepath.Join(dir, assetName))
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, []string{dir}, opened)
+
+	// Corrupted downloads must not be kept
+	data = []byte("corrupted")
+	os.Remove(filepath.Join(dir, assetName))
+	rel.Assets[2].URL = srv.URL + "/invalid"
+	assert.Error(t, au.download(context.Background(), rel))
+	rel.Assets[2].URL = srv.URL + "/" + checksumsFile
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write([]byte("tampered"))
+		default:
+			fmt.Fprintf(w, "%s  %s\n", sha256Hex(data), assetName)
+		}
+	})
+	assert.Error(t, au.download(context.Background(), rel))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+}
@@ -0,0 +1,159 @@
+package autoupdater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-version"
+
+	"osdapp/internal/httpclient"
+)
+
+const (
+	maxFeedSize = 4 * 1024 * 1024
+)
+
+// Feed is the JSON release manifest read by FeedSource. Releases
+// can be split across several pages, with each one pointing to the
+// following using Next.
+//
+//	{
+//	  "releases": [
+//	    {
+//	      "version": "2.1.0",
+//	      "prerelease": false,
+//	      "notes": "Markdown release notes",
+//	      "url": "https://example.com/releases/2.1.0",
+//	      "assets": [
+//	        {"name": "FrSky_OSD-linux-amd64-2.1.0.tar.gz", "url": "FrSky_OSD-linux-amd64-2.1.0.tar.gz"}
+//	      ]
+//	    }
+//	  ],
+//	  "next": "page-2.json"
+//	}
+//
+// Relative URLs are resolved against the URL of the page.
+type Feed struct {
+	Releases []*FeedRelease `json:"releases"`
+	// Next is the URL of the next page, empty in the last one
+	Next string `json:"next,omitempty"`
+}
+
+// FeedRelease represents a release in a Feed
+type FeedRelease struct {
+	Version    string       `json:"version"`
+	Prerelease bool         `json:"prerelease,omitempty"`
+	Notes      string       `json:"notes,omitempty"`
+	URL        string       `json:"url,omitempty"`
+	Assets     []*FeedAsset `json:"assets,omitempty"`
+}
+
+// FeedAsset represents a downloadable asset in a FeedRelease
+type FeedAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// FeedSource reads the releases from a JSON manifest, retrieved
+// over HTTP(S) or from a file:// URL. See Feed for its format.
+type FeedSource struct {
+	URL string
+}
+
+var _ Source = (*FeedSource)(nil)
+
+// AvailableVersions implements the Source interface. The token is
+// the absolute URL of the page to retrieve.
+func (s *FeedSource) AvailableVersions(ctx context.Context, token string) ([]*Release, string, error) {
+	pageURL := s.URL
+	if token != "" {
+		pageURL = token
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := fetch(ctx, httpclient.Default(), pageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxFeedSize))
+	if err != nil {
+		return nil, "", err
+	}
+	var feed Feed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, "", fmt.Errorf("invalid release feed %s: %v", pageURL, err)
+	}
+	resolve := func(ref string) string {
+		if ref == "" {
+			return ""
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+	releases := make([]*Release, 0, len(feed.Releases))
+	for _, fr := range feed.Releases {
+		v, err := version.NewVersion(fr.Version)
+		if err != nil {
+			log.Printf("error parsing version %q in %s: %v, skipping", fr.Version, pageURL, err)
+			continue
+		}
+		rel := &Release{
+			Version:      v.String(),
+			IsPrerelease: fr.Prerelease || v.Prerelease() != "",
+			Notes:        fr.Notes,
+			URL:          resolve(fr.URL),
+		}
+		for _, a := range fr.Assets {
+			rel.Assets = append(rel.Assets, &Asset{
+				Name: a.Name,
+				URL:  resolve(a.URL),
+			})
+		}
+		releases = append(releases, rel)
+	}
+	next := resolve(feed.Next)
+	if next == pageURL {
+		return nil, "", fmt.Errorf("release feed %s points to itself as next page", pageURL)
+	}
+	return releases, next, nil
+}
+
+// fetch returns a reader for the given HTTP(S) or file:// URL,
+// using client for the former
+func fetch(ctx context.Context, client *http.Client, rawurl string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return os.Open(urlFilePath(u))
+	case "http", "https":
+		return httpGet(ctx, client, rawurl)
+	}
+	return nil, fmt.Errorf("unsupported URL scheme %q in %s", u.Scheme, rawurl)
+}
+
+// urlFilePath returns the local path for a file:// URL
+func urlFilePath(u *url.URL) string {
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Windows paths, e.g. /C:/foo
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
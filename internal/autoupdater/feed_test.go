@@ -0,0 +1,186 @@
+package autoupdater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFeedPage1 = `{
+  "releases": [
+    {"version": "1.2.0-beta.1", "url": "releases/1.2.0-beta.1"},
+    {"version": "v1.1.0", "notes": "- Fixes", "assets": [{"name": "%s", "url": "assets/%s"}]}
+  ],
+  "next": "page-2.json"
+}`
+	testFeedPage2 = `{
+  "releases": [
+    {"version": "1.0.0", "url": "https://example.com/1.0.0"},
+    {"version": "invalid"}
+  ]
+}`
+)
+
+func testFeedDir(t *testing.T, assetName string) (string, func()) {
+	dir, err := ioutil.TempDir("", "autoupdater-feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"feed.json":                        fmt.Sprintf(testFeedPage1, assetName, assetName),
+		"page-2.json":                      testFeedPage2,
+		filepath.Join("assets", assetName): "release",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func allReleases(t *testing.T, src Source) []*Release {
+	var releases []*Release
+	var token string
+	for {
+		page, next, err := src.AvailableVersions(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, page...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	return releases
+}
+
+func TestFeedSource(t *testing.T) {
+	dir, cleanup := testFeedDir(t, "app.tar.gz")
+	defer cleanup()
+
+	src, err := NewSource(filepath.Join(dir, "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.IsType(t, &FeedSource{}, src) {
+		return
+	}
+	feedURL := src.(*FeedSource).URL
+	releases := allReleases(t, src)
+	if assert.Len(t, releases, 3) {
+		assert.Equal(t, "1.2.0-beta.1", releases[0].Version)
+		assert.True(t, releases[0].IsPrerelease)
+		assert.Equal(t, feedURL[:len(feedURL)-len("feed.json")]+"releases/1.2.0-beta.1", releases[0].URL)
+
+		assert.Equal(t, "1.1.0", releases[1].Version)
+		assert.False(t, releases[1].IsPrerelease)
+		assert.Equal(t, "- Fixes", releases[1].Notes)
+		if assert.Len(t, releases[1].Assets, 1) {
+			r, err := fetch(context.Background(), http.DefaultClient, releases[1].Assets[0].URL)
+			if assert.NoError(t, err) {
+				data, _ := ioutil.ReadAll(r)
+				r.Close()
+				assert.Equal(t, "release", string(data))
+			}
+		}
+
+		assert.Equal(t, "1.0.0", releases[2].Version)
+		assert.Equal(t, "https://example.com/1.0.0", releases[2].URL)
+	}
+}
+
+func TestFeedSourceHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.json":
+			fmt.Fprintf(w, testFeedPage1, "app.tar.gz", "app.tar.gz")
+		case "/page-2.json":
+			fmt.Fprint(w, testFeedPage2)
+		case "/loop.json":
+			fmt.Fprint(w, `{"releases": [], "next": "loop.json"}`)
+		case "/invalid.json":
+			fmt.Fprint(w, `<html></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src, err := NewSource(srv.URL + "/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases := allReleases(t, src)
+	if assert.Len(t, releases, 3) && assert.Len(t, releases[1].Assets, 1) {
+		assert.Equal(t, srv.URL+"/assets/app.tar.gz", releases[1].Assets[0].URL)
+	}
+
+	for _, name := range []string{"loop.json", "invalid.json", "missing.json"} {
+		_, _, err := (&FeedSource{URL: srv.URL + "/" + name}).AvailableVersions(context.Background(), "")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	src, err := NewSource("https://github.com/FrSkyRC/FrSkyOSDApp")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &GitHubSource{Owner: "FrSkyRC", Repo: "FrSkyOSDApp"}, src)
+	}
+	src, err = NewSource("https://example.com/updates/feed.json")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &FeedSource{URL: "https://example.com/updates/feed.json"}, src)
+	}
+	_, err = NewSource("ftp://example.com/feed.json")
+	assert.Error(t, err)
+}
+
+func TestFeedSourceDownload(t *testing.T) {
+	p := platformForAsset(runtime.GOOS, runtime.GOARCH)
+	if p == nil {
+		t.Skip("no releases for this platform")
+	}
+	assetName := "FrSky_OSD" + p.Tag + "1.1.0" + p.Extension
+	dir, cleanup := testFeedDir(t, assetName)
+	defer cleanup()
+
+	defer func(f func(string) error) { openFile = f }(openFile)
+	openFile = func(string) error { return nil }
+
+	src, err := NewSource(filepath.Join(dir, "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloads := filepath.Join(dir, "downloads")
+	dlg := &fakeDialog{response: DialogResponseDownload}
+	au, err := New(&Options{
+		Version:     "1.0.0",
+		Source:      src,
+		Dialog:      dlg,
+		DownloadDir: downloads,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, au.CheckForUpdates(context.Background()))
+	if assert.Len(t, dlg.shown, 1) {
+		assert.Equal(t, "1.1.0", dlg.shown[0].AvailableRelease.Version)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(downloads, assetName))
+	assert.NoError(t, err)
+	assert.Equal(t, "release", string(data))
+}
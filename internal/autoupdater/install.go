@@ -1,12 +1,251 @@
 package autoupdater
 
-import "errors"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
-func (au *AutoUpdater) canInstallUpdates() bool {
-	// For now no platform supports autoinstall
-	return false
+	"osdapp/internal/httpclient"
+)
+
+const (
+	checksumExtension = ".sha256"
+	checksumsFile     = "SHA256SUMS"
+	maxChecksumSize   = 64 * 1024
+)
+
+func (au *AutoUpdater) canInstallUpdates(rel *Release) bool {
+	if !installSupported {
+		return false
+	}
+	asset := au.platformAsset(rel)
+	if asset == nil || checksumAsset(rel, asset) == nil {
+		return false
+	}
+	exe, err := au.executablePath()
+	if err != nil {
+		return false
+	}
+	return canReplaceExecutable(exe)
+}
+
+// platformAsset returns the asset for the current platform, if any
+func (au *AutoUpdater) platformAsset(rel *Release) *Asset {
+	return matchAsset(rel.Assets, runtime.GOOS, runtime.GOARCH)
+}
+
+// executablePath returns the path to the running executable,
+// with symlinks resolved
+func (au *AutoUpdater) executablePath() (string, error) {
+	if au.executable != "" {
+		return au.executable, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// checksumAsset returns the asset with the SHA-256 checksum for
+// the given one, either as a sidecar file or as a SHA256SUMS file
+// with the checksums of all the assets.
+func checksumAsset(rel *Release, asset *Asset) *Asset {
+	for _, a := range rel.Assets {
+		if a.Name == asset.Name+checksumExtension {
+			return a
+		}
+	}
+	for _, a := range rel.Assets {
+		if a.Name == checksumsFile {
+			return a
+		}
+	}
+	return nil
+}
+
+// parseChecksum finds the SHA-256 for the file with the given name
+// in data, in the format used by sha256sum. If data contains a single
+// checksum without filename, it's returned.
+func parseChecksum(data string, name string) (string, error) {
+	var sum string
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 1 && len(lines) == 1 {
+			sum = fields[0]
+			break
+		}
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			sum = fields[0]
+			break
+		}
+	}
+	if sum == "" {
+		return "", fmt.Errorf("no checksum found for %s", name)
+	}
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q for %s", sum, name)
+	}
+	return strings.ToLower(sum), nil
+}
+
+func httpGet(ctx context.Context, client *http.Client, u string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		err := fmt.Errorf("invalid HTTP response code %d for %s", resp.StatusCode, u)
+		if rle := rateLimitFromResponse(resp, err); rle != nil {
+			return nil, rle
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// downloadAsset downloads the asset to a temporary file in dir, or in
+// the default directory for temporary files if dir is empty. If the
+// release includes a checksum for the asset, it's verified. The caller
+// must remove or rename the returned file.
+func (au *AutoUpdater) downloadAsset(ctx context.Context, rel *Release, asset *Asset, dir string) (string, error) {
+	var expected string
+	if sumAsset := checksumAsset(rel, asset); sumAsset != nil {
+		r, err := fetch(ctx, httpclient.Default(), sumAsset.URL)
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, maxChecksumSize))
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		if expected, err = parseChecksum(string(data), asset.Name); err != nil {
+			return "", err
+		}
+	}
+	r, err := fetch(ctx, httpclient.Default(), asset.URL)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	tmp, err := ioutil.TempFile(dir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); expected != "" && sum != expected {
+			err = fmt.Errorf("downloaded %s has SHA-256 %s, expecting %s", asset.Name, sum, expected)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// downloadAndInstall downloads the release for the current platform,
+// installs it and asks the user to restart the app.
+func (au *AutoUpdater) downloadAndInstall(ctx context.Context, rel *Release) error {
+	asset := au.platformAsset(rel)
+	if asset == nil {
+		return errors.New("no release asset for this platform")
+	}
+	if checksumAsset(rel, asset) == nil {
+		return fmt.Errorf("no checksum available for %s", asset.Name)
+	}
+	p, err := au.downloadAsset(ctx, rel, asset, "")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(p)
+	if err := au.installUpdate(p); err != nil {
+		return err
+	}
+	restart := make(chan bool, 1)
+	go au.opts.Dialog.ShowRestartDialog(&RestartDialogOptions{
+		Version:  rel.Version,
+		Response: func(r bool) { restart <- r },
+	})
+	if <-restart {
+		exe, err := au.executablePath()
+		if err != nil {
+			return err
+		}
+		return restartExecutable(exe)
+	}
+	return nil
+}
+
+// replaceExecutable replaces the executable at exe with the contents
+// of r. The previous executable is kept with a .bak extension and
+// the replacement is atomic, so exe always points to a complete file.
+func replaceExecutable(exe string, r io.Reader) error {
+	st, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(exe)+".new-")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, st.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	backup := exe + ".bak"
+	os.Remove(backup)
+	if err := os.Link(exe, backup); err != nil {
+		if err := copyFile(exe, backup, st.Mode()); err != nil {
+			return fmt.Errorf("could not back up %s: %v", exe, err)
+		}
+	}
+	return os.Rename(tmpName, exe)
 }
 
-func (au *AutoUpdater) installUpdate(downloadedPkgPath string) error {
-	return errors.New("unimplemented")
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
@@ -0,0 +1,109 @@
+package autoupdater
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	installSupported = true
+
+	// accessWriteOK is W_OK from access(2)
+	accessWriteOK = 0x2
+)
+
+// installUpdate extracts the executable from the tarball at
+// downloadedPkgPath and replaces the running one with it
+func (au *AutoUpdater) installUpdate(downloadedPkgPath string) error {
+	exe, err := au.executablePath()
+	if err != nil {
+		return err
+	}
+	name, err := findTarExecutable(downloadedPkgPath, filepath.Base(exe))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(downloadedPkgPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name == name {
+			return replaceExecutable(exe, tr)
+		}
+	}
+	return fmt.Errorf("%s not found in update", name)
+}
+
+// findTarExecutable returns the name of the executable in the
+// given tarball. Files named like the running executable are
+// preferred, otherwise the first executable in a bin directory
+// is used.
+func findTarExecutable(p string, exeName string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var candidate string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Mode&0111 == 0 {
+			continue
+		}
+		if path.Base(hdr.Name) == exeName {
+			return hdr.Name, nil
+		}
+		if candidate == "" && path.Base(path.Dir(hdr.Name)) == "bin" {
+			candidate = hdr.Name
+		}
+	}
+	if candidate == "" {
+		return "", fmt.Errorf("no executable found in update")
+	}
+	return candidate, nil
+}
+
+// canReplaceExecutable returns true iff the directory containing
+// exe is writable, so it can be replaced
+func canReplaceExecutable(exe string) bool {
+	return syscall.Access(filepath.Dir(exe), accessWriteOK) == nil
+}
+
+// restartExecutable replaces the running process with a new one
+// running exe with the same arguments and environment
+func restartExecutable(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
@@ -0,0 +1,111 @@
+package autoupdater
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testInstall(t *testing.T, checksum func(data []byte) string) (exe string, dlg *fakeDialog, cleanup func(), err error) {
+	dir, err := ioutil.TempDir("", "autoupdater-install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe = filepath.Join(dir, "FrSkyOSD")
+	if err := ioutil.WriteFile(exe, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	assetName := fmt.Sprintf("FrSky_OSD-%s-%s-1.1.0.tar.gz", runtime.GOOS, runtime.GOARCH)
+	tarball := testTarball(t, map[string]string{"usr/local/bin/FrSkyOSD": "new"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(tarball)
+		case "/" + assetName + checksumExtension:
+			fmt.Fprintf(w, "%s  %s\n", checksum(tarball), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	src := &fakeSource{releases: []*Release{{
+		Version: "1.1.0",
+		Assets: []*Asset{
+			{Name: assetName, URL: srv.URL + "/" + assetName},
+			{Name: assetName + checksumExtension, URL: srv.URL + "/" + assetName + checksumExtension},
+		},
+	}}}
+	dlg = &fakeDialog{response: DialogResponseDownloadAndInstall}
+	au := testAutoUpdater(t, src, dlg, nil)
+	au.executable = exe
+	err = au.CheckForUpdates(context.Background())
+	cleanup = func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+	return exe, dlg, cleanup, err
+}
+
+func TestDownloadAndInstall(t *testing.T) {
+	exe, dlg, cleanup, err := testInstall(t, sha256Hex)
+	defer cleanup()
+	assert.NoError(t, err)
+	if assert.Len(t, dlg.shown, 1) {
+		assert.True(t, dlg.shown[0].AllowsResponse(DialogResponseDownloadAndInstall))
+	}
+	if assert.Len(t, dlg.restarted, 1) {
+		assert.Equal(t, "1.1.0", dlg.restarted[0].Version)
+	}
+	data, err := ioutil.ReadFile(exe)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	st, err := os.Stat(exe)
+	if assert.NoError(t, err) {
+		assert.NotZero(t, st.Mode()&0100)
+	}
+	backup, err := ioutil.ReadFile(exe + ".bak")
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(backup))
+}
+
+func TestDownloadAndInstallChecksumMismatch(t *testing.T) {
+	exe, dlg, cleanup, err := testInstall(t, func([]byte) string { return sha256Hex([]byte("other")) })
+	defer cleanup()
+	assert.Error(t, err)
+	assert.Len(t, dlg.restarted, 0)
+	data, err := ioutil.ReadFile(exe)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+}
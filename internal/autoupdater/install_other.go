@@ -0,0 +1,23 @@
+// +build !linux
+
+package autoupdater
+
+import "errors"
+
+const (
+	installSupported = false
+)
+
+var errInstallUnsupported = errors.New("installing updates is not supported on this platform")
+
+func (au *AutoUpdater) installUpdate(downloadedPkgPath string) error {
+	return errInstallUnsupported
+}
+
+func canReplaceExecutable(exe string) bool {
+	return false
+}
+
+func restartExecutable(exe string) error {
+	return errInstallUnsupported
+}
@@ -0,0 +1,63 @@
+package autoupdater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchAsset(t *testing.T) {
+	assets := []*Asset{
+		{Name: "FrSky_OSD-macOS-2.1.0.zip"},
+		{Name: "FrSky_OSD-linux-386-2.1.0.tar.gz"},
+		{Name: "FrSky_OSD-linux-amd64-2.1.0.tar.gz"},
+		{Name: "FrSky_OSD-linux-amd64-2.1.0.tar.gz.sha256"},
+		{Name: "FrSky_OSD-win32-2.1.0.zip"},
+		{Name: "FrSky_OSD-win64-2.1.0.zip"},
+		{Name: "FrSky_OSD-win64-2.1.0.zip.sha256"},
+	}
+	cases := []struct {
+		goos, goarch string
+		name         string
+	}{
+		{"linux", "amd64", "FrSky_OSD-linux-amd64-2.1.0.tar.gz"},
+		{"linux", "386", "FrSky_OSD-linux-386-2.1.0.tar.gz"},
+		{"linux", "arm64", ""},
+		{"windows", "amd64", "FrSky_OSD-win64-2.1.0.zip"},
+		{"windows", "386", "FrSky_OSD-win32-2.1.0.zip"},
+		{"windows", "arm", ""},
+		{"darwin", "amd64", "FrSky_OSD-macOS-2.1.0.zip"},
+		{"freebsd", "amd64", ""},
+	}
+	for _, c := range cases {
+		a := matchAsset(assets, c.goos, c.goarch)
+		if c.name == "" {
+			assert.Nil(t, a, "%s/%s", c.goos, c.goarch)
+		} else if assert.NotNil(t, a, "%s/%s", c.goos, c.goarch) {
+			assert.Equal(t, c.name, a.Name)
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	const sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s, err := parseChecksum(sum+"\n", "a.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, s)
+
+	s, err = parseChecksum("0000  b.tar.gz\n"+sum+" *a.tar.gz\n", "a.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, s)
+
+	_, err = parseChecksum(sum+"  b.tar.gz\n", "a.tar.gz")
+	assert.Error(t, err)
+	_, err = parseChecksum("1234  a.tar.gz\n", "a.tar.gz")
+	assert.Error(t, err)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
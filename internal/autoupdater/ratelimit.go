@@ -0,0 +1,70 @@
+package autoupdater
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+const (
+	// defaultRetryAfter is used when a server signals a rate
+	// limit without telling when to retry
+	defaultRetryAfter = 1 * time.Hour
+)
+
+// RateLimitError is returned by a Source when the server rejected
+// the request because of rate limiting. No requests should be
+// made until Reset.
+type RateLimitError struct {
+	Reset time.Time
+	Err   error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited until %s: %v", e.Reset.Format(time.RFC3339), e.Err)
+}
+
+// rateLimitFromResponse returns a *RateLimitError if resp indicates
+// that the client is being rate limited, either with a Retry-After
+// header or with X-RateLimit-Remaining: 0 and X-RateLimit-Reset.
+// Otherwise it returns nil.
+func rateLimitFromResponse(resp *http.Response, err error) *RateLimitError {
+	now := time.Now()
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, perr := strconv.Atoi(s); perr == nil {
+			return &RateLimitError{Reset: now.Add(time.Duration(secs) * time.Second), Err: err}
+		}
+		if t, perr := http.ParseTime(s); perr == nil {
+			return &RateLimitError{Reset: t, Err: err}
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, perr := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); perr == nil {
+			return &RateLimitError{Reset: time.Unix(secs, 0), Err: err}
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{Reset: now.Add(defaultRetryAfter), Err: err}
+	}
+	return nil
+}
+
+// gitHubRateLimit converts the rate limiting errors returned by
+// go-github into a *RateLimitError. Other errors are returned
+// unchanged.
+func gitHubRateLimit(err error) error {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		return &RateLimitError{Reset: e.Rate.Reset.Time, Err: err}
+	case *github.AbuseRateLimitError:
+		retryAfter := defaultRetryAfter
+		if e.RetryAfter != nil {
+			retryAfter = *e.RetryAfter
+		}
+		return &RateLimitError{Reset: time.Now().Add(retryAfter), Err: err}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package autoupdater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingSource struct {
+	mu      sync.Mutex
+	fetched int
+	err     error
+}
+
+func (s *countingSource) AvailableVersions(ctx context.Context, token string) ([]*Release, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched++
+	return nil, "", s.err
+}
+
+func (s *countingSource) Fetched() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetched
+}
+
+// runSchedule runs the scheduler until the source has been
+// queried n times or the timeout expires
+func runSchedule(au *AutoUpdater, src *countingSource, n int, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		au.ScheduleCheckingForUpdates(ctx, time.Hour)
+		close(done)
+	}()
+	for src.Fetched() < n && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestScheduleSkipsRecentCheck(t *testing.T) {
+	store := &memoryStore{}
+	store.Save(lastCheckKey, strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	src := &countingSource{}
+	au := testAutoUpdater(t, src, &fakeDialog{}, store)
+	runSchedule(au, src, 1, 50*time.Millisecond)
+	assert.Equal(t, 0, src.Fetched())
+}
+
+func TestSchedulePersistsLastCheck(t *testing.T) {
+	store := &memoryStore{}
+	src := &countingSource{err: errors.New("offline")}
+	au := testAutoUpdater(t, src, &fakeDialog{}, store)
+	runSchedule(au, src, 1, 5*time.Second)
+	assert.Equal(t, 1, src.Fetched())
+	last, ok := au.loadTime(lastCheckKey)
+	if assert.True(t, ok) {
+		assert.WithinDuration(t, time.Now(), last, 5*time.Second)
+	}
+	assert.InDelta(t, float64(time.Hour), float64(au.nextCheckDelay(time.Hour)), float64(10*time.Second))
+}
+
+func TestScheduleRateLimit(t *testing.T) {
+	store := &memoryStore{}
+	reset := time.Now().Add(3 * time.Hour)
+	src := &countingSource{err: &RateLimitError{Reset: reset, Err: errors.New("limited")}}
+	au := testAutoUpdater(t, src, &fakeDialog{}, store)
+	runSchedule(au, src, 1, 5*time.Second)
+	assert.Equal(t, 1, src.Fetched())
+	_, ok := au.loadTime(lastCheckKey)
+	assert.False(t, ok)
+	// Next check must wait for the reset, even if it's after the interval
+	assert.InDelta(t, float64(3*time.Hour), float64(au.nextCheckDelay(time.Hour)), float64(10*time.Second))
+}
+
+func TestRateLimitFromResponse(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(time.Hour).Truncate(time.Second)
+	cases := []struct {
+		status  int
+		headers map[string]string
+		reset   time.Time
+	}{
+		{429, map[string]string{"Retry-After": "120"}, now.Add(2 * time.Minute)},
+		{503, map[string]string{"Retry-After": reset.UTC().Format(http.TimeFormat)}, reset},
+		{403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)}, reset},
+		{429, nil, now.Add(defaultRetryAfter)},
+		{403, map[string]string{"X-RateLimit-Remaining": "10"}, time.Time{}},
+		{404, nil, time.Time{}},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.status, Header: make(http.Header)}
+		for k, v := range c.headers {
+			resp.Header.Set(k, v)
+		}
+		rle := rateLimitFromResponse(resp, errors.New("error"))
+		if c.reset.IsZero() {
+			assert.Nil(t, rle, "%d %v", c.status, c.headers)
+		} else if assert.NotNil(t, rle, "%d %v", c.status, c.headers) {
+			assert.WithinDuration(t, c.reset, rle.Reset, 2*time.Second)
+		}
+	}
+
+	reset = now.Add(30 * time.Minute)
+	err := gitHubRateLimit(&github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: reset}}})
+	if rle, ok := err.(*RateLimitError); assert.True(t, ok) {
+		assert.Equal(t, reset, rle.Reset)
+	}
+	other := errors.New("other")
+	assert.Equal(t, other, gitHubRateLimit(other))
+}
+
+func TestFeedSourceRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	_, _, err := (&FeedSource{URL: srv.URL + "/feed.json"}).AvailableVersions(context.Background(), "")
+	_, ok := err.(*RateLimitError)
+	assert.True(t, ok, "error is %T", err)
+}
+
+func TestETagTransport(t *testing.T) {
+	var mu sync.Mutex
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		const etag = `"v1"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, `{"releases": [{"version": "1.1.0"}]}`)
+	}))
+	defer srv.Close()
+
+	src := &FeedSource{URL: srv.URL + "/feed.json"}
+	for ii := 0; ii < 3; ii++ {
+		releases, _, err := src.AvailableVersions(context.Background(), "")
+		if assert.NoError(t, err) && assert.Len(t, releases, 1) {
+			assert.Equal(t, "1.1.0", releases[0].Version)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 2, notModified)
+}
@@ -5,15 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v30/github"
 	"github.com/hashicorp/go-version"
-	"golang.org/x/oauth2"
+
+	"osdapp/internal/httpclient"
 )
 
 // Source is an interface that provides the available releases
@@ -60,14 +60,7 @@ func (s *GitHubSource) parseTag(tag string) (string, error) {
 
 // AvailableVersions implements the Source interface
 func (s *GitHubSource) AvailableVersions(ctx context.Context, token string) ([]*Release, string, error) {
-	var httpClient *http.Client
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
-		)
-		httpClient = oauth2.NewClient(ctx, ts)
-	}
-	client := github.NewClient(httpClient)
+	client := httpclient.GitHub()
 	page := 0
 	if token != "" {
 		nextPage, err := strconv.Atoi(token)
@@ -81,7 +74,7 @@ func (s *GitHubSource) AvailableVersions(ctx context.Context, token string) ([]*
 	}
 	ghReleases, resp, err := client.Repositories.ListReleases(ctx, s.Owner, s.Repo, opts)
 	if err != nil {
-		return nil, "", err
+		return nil, "", gitHubRateLimit(err)
 	}
 	releases := make([]*Release, 0, len(ghReleases))
 	for _, r := range ghReleases {
@@ -114,12 +107,18 @@ func (s *GitHubSource) AvailableVersions(ctx context.Context, token string) ([]*
 }
 
 // NewSource finds a suitable source from the given origin
-// and returns it.
+// and returns it. GitHub repository URLs create a GitHubSource,
+// while other HTTP(S) and file:// URLs create a FeedSource.
+// Local paths are converted to file:// URLs.
 func NewSource(origin string) (Source, error) {
+	origin = strings.TrimSpace(origin)
+	if filepath.IsAbs(origin) {
+		return &FeedSource{URL: fileURL(origin)}, nil
+	}
 	u, err := url.Parse(origin)
 	if err == nil {
 		if u.Hostname() == "github.com" && u.Path != "" {
-			parts := strings.Split(u.Path[1:], "/")
+			parts := strings.Split(strings.Trim(u.Path, "/"), "/")
 			if len(parts) == 2 {
 				return &GitHubSource{
 					Owner: parts[0],
@@ -127,6 +126,20 @@ func NewSource(origin string) (Source, error) {
 				}, nil
 			}
 		}
+		switch u.Scheme {
+		case "http", "https", "file":
+			return &FeedSource{URL: origin}, nil
+		}
 	}
 	return nil, fmt.Errorf("could not create a Source from %q", origin)
 }
+
+// fileURL returns the file:// URL for the given local path
+func fileURL(p string) string {
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		// Windows paths, e.g. C:/foo
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
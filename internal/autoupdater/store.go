@@ -0,0 +1,102 @@
+package autoupdater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"osdapp/internal/atomicfile"
+)
+
+const (
+	skippedVersionKey = "skipped_version"
+	lastCheckKey      = "last_check"
+	rateLimitResetKey = "rate_limit_reset"
+)
+
+// Store persists the state of the AutoUpdater between runs,
+// like the release skipped by the user or the time of the
+// last check. Keys without a value must return an empty
+// string and no error.
+type Store interface {
+	Load(key string) (string, error)
+	Save(key string, value string) error
+}
+
+// FileStore is a Store that keeps its data in a JSON file
+type FileStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileStore returns a *FileStore that saves its data to
+// the file at p. Parent directories are created as needed.
+func NewFileStore(p string) *FileStore {
+	return &FileStore{Path: p}
+}
+
+func (s *FileStore) read() (map[string]string, error) {
+	values := make(map[string]string)
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Load implements the Store interface
+func (s *FileStore) Load(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	return values[key], nil
+}
+
+// Save implements the Store interface
+func (s *FileStore) Save(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	values[key] = value
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.Path, data, 0644)
+}
+
+// memoryStore is used when no Store is provided, so skipped
+// releases are only remembered while the app is running.
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (s *memoryStore) Load(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key], nil
+}
+
+func (s *memoryStore) Save(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[key] = value
+	return nil
+}
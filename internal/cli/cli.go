@@ -0,0 +1,442 @@
+// Package cli implements the headless commands of the app, used to
+// script OSD provisioning without going through the GUI. Every
+// command prints its result as text or, with -json, as a single
+// JSON document in stdout. Progress and diagnostics go to stderr.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"osdapp/firmware"
+	"osdapp/frskyosd"
+	"osdapp/internal/device"
+)
+
+// Exit codes returned by Run
+const (
+	// ExitOK indicates that the command succeeded
+	ExitOK = 0
+	// ExitError indicates that the command failed
+	ExitError = 1
+	// ExitUsage indicates invalid arguments
+	ExitUsage = 2
+	// ExitNoDevice indicates that no OSD could be found or
+	// connected to
+	ExitNoDevice = 3
+	// ExitUnsupported indicates that the OSD doesn't support
+	// the operation, because it's in bootloader mode or its
+	// firmware is too old
+	ExitUnsupported = 4
+	// ExitMismatch indicates that a verification found
+	// differences
+	ExitMismatch = 5
+)
+
+// Options contains the environment for the commands
+type Options struct {
+	// Stdout receives the command results. If nil, os.Stdout is used.
+	Stdout io.Writer
+	// Stderr receives progress and errors. If nil, os.Stderr is used.
+	Stderr io.Writer
+	// FirmwareSources returns the sources used to list and
+	// flash firmwares. If nil, firmware.DefaultSources is used.
+	FirmwareSources func() ([]firmware.Source, error)
+	// FirmwareCache, if non-nil, is used to store downloaded
+	// firmwares and to list them when the sources are unreachable.
+	FirmwareCache *firmware.Cache
+}
+
+// exitError is an error with the exit code for it
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func usageError(format string, args ...interface{}) error {
+	return &exitError{code: ExitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if ee, ok := err.(*exitError); ok {
+		return ee.code
+	}
+	if err == frskyosd.ErrUnsupported {
+		return ExitUnsupported
+	}
+	return ExitError
+}
+
+type command struct {
+	name string
+	// args describes the positional arguments for the usage
+	args string
+	help string
+	// nargs is the number of positional arguments, -1 for any
+	nargs int
+	setup func(fs *flag.FlagSet, e *env)
+	run   func(e *env) (interface{}, error)
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "ports", help: "List the available ports", run: runPorts},
+		{name: "info", help: "Show the OSD firmware and capabilities", run: runInfo},
+		{name: "font upload", args: "<file.mcm>", nargs: 1, help: "Upload a font to the OSD", setup: setupFontUpload, run: runFontUpload},
+		{name: "font download", args: "<file.mcm>", nargs: 1, help: "Save the font in the OSD to a file", run: runFontDownload},
+		{name: "font verify", args: "<file.mcm>", nargs: 1, help: "Check if the font in the OSD matches a file", run: runFontVerify},
+		{name: "firmware list", help: "List the available firmwares", run: runFirmwareList},
+		{name: "firmware flash", args: "<file|version|latest>", nargs: 1, help: "Flash a firmware", setup: setupFirmwareFlash, run: runFirmwareFlash},
+		{name: "firmware erase", help: "Erase the firmware, leaving only the bootloader", run: runFirmwareErase},
+		{name: "settings get", help: "Show the OSD settings", run: runSettingsGet},
+		{name: "settings set", args: "<name>=<value>...", nargs: -1, help: "Change the OSD settings until it reboots", run: runSettingsSet},
+		{name: "settings save", help: "Save the current settings to the OSD", run: runSettingsSave},
+		{name: "settings reset", help: "Restore the default settings until the OSD reboots", run: runSettingsReset},
+		{name: "draw", args: "<script>", nargs: 1, help: "Run a drawing script, use - for stdin", run: runDraw},
+		{name: "provision", args: "<manifest.json>", nargs: 1, help: "Apply a manifest to every OSD in parallel", setup: setupProvision, run: runProvision},
+	}
+}
+
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c, args[1:]
+		}
+		if len(args) > 1 && c.name == args[0]+" "+args[1] {
+			return c, args[2:]
+		}
+	}
+	return nil, nil
+}
+
+// env is the state of a running command
+type env struct {
+	ctx    context.Context
+	opts   *Options
+	stdout io.Writer
+	stderr io.Writer
+	port   string
+	json   bool
+	args   []string
+	dev    device.Device
+	info   *frskyosd.InfoMessage
+
+	// Command specific flags
+	force    bool
+	beta     bool
+	symbols  string
+	report   string
+	ports    string
+	parallel int
+}
+
+// Run runs the command given by args, without the program name,
+// and returns the exit code.
+func Run(args []string, opts *Options) int {
+	if opts == nil {
+		opts = &Options{}
+	}
+	e := &env{opts: opts, stdout: opts.Stdout, stderr: opts.Stderr}
+	if e.stdout == nil {
+		e.stdout = os.Stdout
+	}
+	if e.stderr == nil {
+		e.stderr = os.Stderr
+	}
+	cmd, cmdArgs := findCommand(args)
+	if cmd == nil {
+		if len(args) > 0 {
+			fmt.Fprintf(e.stderr, "unknown command %q\n\n", strings.Join(args, " "))
+		}
+		e.usage()
+		return ExitUsage
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&e.port, "port", os.Getenv("FRSKY_OSD_PORT"), "Port the OSD is connected to, required if there are several")
+	fs.BoolVar(&e.json, "json", false, "Print the result as JSON")
+	if cmd.setup != nil {
+		cmd.setup(fs, e)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: %s [flags] %s\n\n%s\n\n", cmd.name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		return ExitUsage
+	}
+	e.args = fs.Args()
+	if (cmd.nargs >= 0 && len(e.args) != cmd.nargs) || (cmd.nargs < 0 && len(e.args) == 0) {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	e.ctx = ctx
+
+	result, err := cmd.run(e)
+	if e.dev != nil {
+		e.dev.Close()
+	}
+	return e.finish(result, err)
+}
+
+// finish prints the result and the error, returning the exit code.
+// In JSON mode, errors without a result are printed to stdout as
+// an object with the error and exit_code fields.
+func (e *env) finish(result interface{}, err error) int {
+	code := exitCode(err)
+	if result != nil {
+		if e.json {
+			e.printJSON(result)
+		} else {
+			fmt.Fprintln(e.stdout, result)
+		}
+	}
+	if err != nil {
+		if e.json && result == nil {
+			e.printJSON(&errorResult{Error: err.Error(), ExitCode: code})
+		}
+		fmt.Fprintf(e.stderr, "error: %v\n", err)
+	}
+	return code
+}
+
+type errorResult struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code"`
+}
+
+func (e *env) printJSON(v interface{}) {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(e.stderr, "error encoding result: %v\n", err)
+	}
+}
+
+func (e *env) usage() {
+	fmt.Fprintf(e.stderr, "usage: %s [-debug] <command> [flags] [args]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, c := range commands {
+		fmt.Fprintf(e.stderr, "  %-40s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+	fmt.Fprintf(e.stderr, "\nAll commands accept -port and -json. Use <command> -h for its flags.\n")
+}
+
+// progress prints a progress message to stderr, overwriting the
+// previous one when stderr is a terminal.
+func (e *env) progress(format string, args ...interface{}) {
+	if !isTerminal(e.stderr) {
+		return
+	}
+	fmt.Fprintf(e.stderr, "\r\x1b[K"+format, args...)
+}
+
+// progressDone ends a sequence of progress messages
+func (e *env) progressDone() {
+	if isTerminal(e.stderr) {
+		fmt.Fprint(e.stderr, "\r\x1b[K")
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// selectPort returns the port given with -port or, if there's only
+// one available port, that one.
+func (e *env) selectPort() (string, error) {
+	if e.port != "" {
+		return e.port, nil
+	}
+	ports, err := device.AvailablePorts()
+	if err != nil {
+		return "", &exitError{code: ExitNoDevice, err: err}
+	}
+	switch len(ports) {
+	case 0:
+		return "", &exitError{code: ExitNoDevice, err: errors.New("no ports found")}
+	case 1:
+		return ports[0], nil
+	}
+	sort.Strings(ports)
+	return "", usageError("several ports found (%s), select one with -port", strings.Join(ports, ", "))
+}
+
+// connect opens the connection to the OSD and retrieves its info
+func (e *env) connect() (device.Device, error) {
+	if e.dev != nil {
+		return e.dev, nil
+	}
+	port, err := e.selectPort()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := device.Open(port)
+	if err != nil {
+		return nil, &exitError{code: ExitNoDevice, err: fmt.Errorf("%s: %v", port, err)}
+	}
+	info, err := dev.Info()
+	if err != nil {
+		dev.Close()
+		return nil, &exitError{code: ExitNoDevice, err: fmt.Errorf("%s: %v", port, err)}
+	}
+	e.port = port
+	e.dev = dev
+	e.info = info
+	return dev, nil
+}
+
+// readInput reads the file at p, or stdin if p is "-"
+func readInput(p string) ([]byte, error) {
+	if p == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(p)
+}
+
+type portsResult struct {
+	Ports []string `json:"ports"`
+}
+
+func (r *portsResult) String() string {
+	return strings.Join(r.Ports, "\n")
+}
+
+func runPorts(e *env) (interface{}, error) {
+	ports, err := device.AvailablePorts()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ports)
+	if ports == nil {
+		ports = []string{}
+	}
+	return &portsResult{Ports: ports}, nil
+}
+
+type infoResult struct {
+	Port            string `json:"port"`
+	Bootloader      bool   `json:"bootloader"`
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	TVStandard      string `json:"tv_standard,omitempty"`
+	CameraDetected  bool   `json:"camera_detected"`
+	Grid            struct {
+		Rows    int `json:"rows"`
+		Columns int `json:"columns"`
+	} `json:"grid"`
+	Pixels struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"pixels"`
+	Capabilities struct {
+		Fonts    bool `json:"fonts"`
+		Settings bool `json:"settings"`
+		Drawing  bool `json:"drawing"`
+		Widgets  bool `json:"widgets"`
+	} `json:"capabilities"`
+}
+
+func (r *infoResult) String() string {
+	if r.Bootloader {
+		return fmt.Sprintf("Port: %s\nBootloader mode, flash a firmware to recover the OSD", r.Port)
+	}
+	var caps []string
+	for _, c := range []struct {
+		name string
+		has  bool
+	}{
+		{"fonts", r.Capabilities.Fonts},
+		{"settings", r.Capabilities.Settings},
+		{"drawing", r.Capabilities.Drawing},
+		{"widgets", r.Capabilities.Widgets},
+	} {
+		if c.has {
+			caps = append(caps, c.name)
+		}
+	}
+	lines := []string{
+		"Port: " + r.Port,
+		"Firmware: " + r.FirmwareVersion,
+		fmt.Sprintf("Video: %s, camera detected: %v", r.TVStandard, r.CameraDetected),
+		fmt.Sprintf("Grid: %dx%d", r.Grid.Columns, r.Grid.Rows),
+		fmt.Sprintf("Pixels: %dx%d", r.Pixels.Width, r.Pixels.Height),
+		"Capabilities: " + strings.Join(caps, ", "),
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tvStandardName(s frskyosd.TVStandard) string {
+	switch s {
+	case frskyosd.TVStandardNTSC:
+		return "NTSC"
+	case frskyosd.TVStandardPAL:
+		return "PAL"
+	}
+	return "unknown"
+}
+
+func runInfo(e *env) (interface{}, error) {
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := dev.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	info := e.info
+	r := &infoResult{Port: e.port, Bootloader: info.IsBootloader}
+	if !info.IsBootloader {
+		r.FirmwareVersion = info.FirmwareVersion().String()
+		r.TVStandard = tvStandardName(info.TVStandard)
+		r.CameraDetected = info.HasDetectedCamera
+		r.Grid.Rows = int(info.Grid.Rows)
+		r.Grid.Columns = int(info.Grid.Columns)
+		r.Pixels.Width = int(info.Pixels.Width)
+		r.Pixels.Height = int(info.Pixels.Height)
+	}
+	r.Capabilities.Fonts = caps.Fonts
+	r.Capabilities.Settings = caps.Settings
+	r.Capabilities.Drawing = caps.Drawing
+	r.Capabilities.Widgets = caps.Widgets
+	return r, nil
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+
+	"osdapp/frskyosd"
+	"osdapp/internal/device/devicetest"
+)
+
+func run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &Options{Stdout: &stdout, Stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := run()
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "font upload")
+
+	code, _, stderr = run("font", "rename")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "unknown command")
+
+	code, _, _ = run("font", "upload")
+	assert.Equal(t, ExitUsage, code)
+}
+
+func TestPortSelection(t *testing.T) {
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{})()
+	code, stdout, _ := run("info", "-json")
+	assert.Equal(t, ExitNoDevice, code)
+	var res errorResult
+	if assert.NoError(t, json.Unmarshal([]byte(stdout), &res)) {
+		assert.Equal(t, ExitNoDevice, res.ExitCode)
+		assert.Equal(t, "no ports found", res.Error)
+	}
+
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"a": devicetest.NewFake("2.0.0"), "b": devicetest.NewFake("2.0.0")})()
+	code, _, stderr := run("info")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "several ports found (a, b)")
+
+	code, _, _ = run("info", "-port", "c")
+	assert.Equal(t, ExitNoDevice, code)
+
+	code, stdout, _ = run("ports", "-json")
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"ports": ["a", "b"]}`, stdout)
+}
+
+func TestInfo(t *testing.T) {
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+	code, stdout, _ := run("info", "-json")
+	assert.Equal(t, ExitOK, code)
+	var res infoResult
+	if assert.NoError(t, json.Unmarshal([]byte(stdout), &res)) {
+		assert.Equal(t, "osd", res.Port)
+		assert.Equal(t, "2.0.0", res.FirmwareVersion)
+		assert.Equal(t, "PAL", res.TVStandard)
+		assert.Equal(t, 30, res.Grid.Columns)
+		assert.True(t, res.Capabilities.Settings)
+		assert.True(t, res.Capabilities.Drawing)
+	}
+	assert.True(t, dev.Closed)
+}
+
+func TestFont(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	p := filepath.Join(dir, "font.mcm")
+	code, _, _ := run("font", "download", p)
+	assert.Equal(t, ExitOK, code)
+
+	code, stdout, _ := run("font", "verify", "-json", p)
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"file": "`+p+`", "match": true, "differences": []}`, stdout)
+
+	dev.Font[3] = bytes.Repeat([]byte{0xAA}, mcm.CharBytes)
+	dev.Font[4] = dev.Font[3]
+	dev.Font[10] = dev.Font[3]
+	code, stdout, _ = run("font", "verify", "-json", p)
+	assert.Equal(t, ExitMismatch, code)
+	assert.JSONEq(t, `{"file": "`+p+`", "match": false, "differences": ["3-4", "10"]}`, stdout)
+
+	code, _, _ = run("font", "upload", p)
+	assert.Equal(t, ExitOK, code)
+	code, _, _ = run("font", "verify", p)
+	assert.Equal(t, ExitOK, code)
+
+	code, _, _ = run("font", "upload", "-symbols", "unknown", p)
+	assert.Equal(t, ExitUsage, code)
+}
+
+func TestSettings(t *testing.T) {
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	code, stdout, _ := run("settings", "set", "-json", "brightness=60", "vertical-offset=-3")
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"brightness": 50, "horizontal_offset": 0, "vertical_offset": -3, "saved": false}`, stdout)
+	assert.False(t, dev.Saved)
+
+	code, stdout, _ = run("settings", "save", "-json")
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"brightness": 50, "horizontal_offset": 0, "vertical_offset": -3, "saved": true}`, stdout)
+	assert.True(t, dev.Saved)
+
+	code, _, _ = run("settings", "reset")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, frskyosd.SettingsMessage{}, dev.Settings)
+
+	for _, arg := range []string{"brightness", "contrast=1", "brightness=200", "brightness=x"} {
+		code, _, _ = run("settings", "set", arg)
+		assert.Equal(t, ExitUsage, code, arg)
+	}
+}
+
+func TestBootloader(t *testing.T) {
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	code, stdout, _ := run("firmware", "erase", "-json")
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"erased": true}`, stdout)
+	assert.True(t, dev.Erased)
+
+	code, _, _ = run("settings", "get")
+	assert.Equal(t, ExitUnsupported, code)
+
+	code, stdout, _ = run("info", "-json")
+	assert.Equal(t, ExitOK, code)
+	var res infoResult
+	if assert.NoError(t, json.Unmarshal([]byte(stdout), &res)) {
+		assert.True(t, res.Bootloader)
+		assert.Empty(t, res.FirmwareVersion)
+	}
+}
+
+func TestFirmwareFlashInvalid(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	p := filepath.Join(dir, "firmware.bin")
+	if err := ioutil.WriteFile(p, []byte("not a firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := run("firmware", "flash", p)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "-force")
+	assert.Nil(t, dev.Flashed)
+
+	code, stdout, _ := run("firmware", "flash", "-force", "-json", p)
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"file": "firmware.bin", "firmware_version": "2.0.0"}`, stdout)
+	assert.Equal(t, []byte("not a firmware"), dev.Flashed)
+}
+
+func TestFirmwareFlashUnknown(t *testing.T) {
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	code, _, stderr := run("firmware", "flash", "foo")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, `"foo" is neither a file nor a valid version`)
+	assert.Nil(t, dev.Flashed)
+}
+
+func TestDraw(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	dev := devicetest.NewFake("2.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"osd": dev})()
+
+	p := filepath.Join(dir, "script")
+	script := "# Test\nbegin\nstroke-width 3\nstroke-color White\nmove 1 2\nline 10 -2\nfill-rect 0 0 5 5\ncommit\n"
+	if err := ioutil.WriteFile(p, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, _ := run("draw", "-json", p)
+	assert.Equal(t, ExitOK, code)
+	assert.JSONEq(t, `{"commands": 7}`, stdout)
+	assert.Equal(t, []string{"begin", "stroke-width 3", "stroke-color 2", "move 1 2", "line 10 -2", "fill-rect 0 0 5 5", "commit"}, dev.Calls)
+
+	dev.Bootloader = true
+	code, _, stderr := run("draw", p)
+	assert.Equal(t, ExitUnsupported, code)
+	assert.Contains(t, stderr, "line 2: begin")
+}
+
+func TestProvision(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{})()
+
+	p := filepath.Join(dir, "manifest.json")
+	if err := ioutil.WriteFile(p, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := run("provision", p)
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "manifest has no firmware, font or settings")
+
+	if err := ioutil.WriteFile(p, []byte(`{"settings": {"brightness": 10}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ = run("provision", p)
+	assert.Equal(t, ExitNoDevice, code)
+
+	report := filepath.Join(dir, "report.csv")
+	missing := filepath.Join(dir, "missing")
+	code, stdout, stderr := run("provision", "-json", "-report", report, "-ports", missing, p)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, missing+": Failed")
+	var res provisionResult
+	if assert.NoError(t, json.Unmarshal([]byte(stdout), &res)) {
+		assert.Equal(t, 1, res.Failed)
+		assert.Equal(t, report, res.Report)
+		if assert.Len(t, res.Results, 1) {
+			assert.Equal(t, missing, res.Results[0].Port)
+			assert.False(t, res.Results[0].Passed)
+		}
+	}
+	data, err := ioutil.ReadFile(report)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), missing+",false,")
+	}
+}
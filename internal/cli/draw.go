@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"osdapp/frskyosd"
+	"osdapp/internal/device"
+)
+
+// drawCommand is a command accepted in drawing scripts. Scripts
+// have one command per line followed by its arguments, separated
+// by spaces. Empty lines and lines starting with # are ignored.
+type drawCommand struct {
+	name string
+	// args describes the arguments, also used to count them
+	args []string
+	run  func(d device.Drawer, args []int) error
+}
+
+var colorNames = map[string]frskyosd.Color{
+	"black":       frskyosd.CBlack,
+	"transparent": frskyosd.CTransparent,
+	"white":       frskyosd.CWhite,
+	"gray":        frskyosd.CGray,
+}
+
+var drawCommands = []*drawCommand{
+	{name: "begin", run: func(d device.Drawer, _ []int) error { return d.TransactionBegin() }},
+	{name: "begin-reset", run: func(d device.Drawer, _ []int) error { return d.TransactionBeginResettingDrawing() }},
+	{name: "commit", run: func(d device.Drawer, _ []int) error { return d.TransactionCommit() }},
+	{name: "reset", run: func(d device.Drawer, _ []int) error { return d.ResetDrawing() }},
+	{name: "clear", run: func(d device.Drawer, _ []int) error { return d.ClearScreen() }},
+	{name: "stroke-color", args: []string{"color"}, run: func(d device.Drawer, args []int) error {
+		return d.SetStrokeColor(frskyosd.Color(args[0]))
+	}},
+	{name: "fill-color", args: []string{"color"}, run: func(d device.Drawer, args []int) error {
+		return d.SetFillColor(frskyosd.Color(args[0]))
+	}},
+	{name: "stroke-width", args: []string{"width"}, run: func(d device.Drawer, args []int) error {
+		return d.SetStrokeWidth(args[0])
+	}},
+	{name: "move", args: []string{"x", "y"}, run: func(d device.Drawer, args []int) error {
+		return d.MoveToPoint(args[0], args[1])
+	}},
+	{name: "line", args: []string{"x", "y"}, run: func(d device.Drawer, args []int) error {
+		return d.StrokeLineToPoint(args[0], args[1])
+	}},
+	{name: "fill-rect", args: []string{"x", "y", "width", "height"}, run: func(d device.Drawer, args []int) error {
+		return d.FillRect(args[0], args[1], uint(args[2]), uint(args[3]))
+	}},
+}
+
+// drawStep is a parsed line of a drawing script
+type drawStep struct {
+	line int
+	cmd  *drawCommand
+	args []int
+}
+
+// run runs the step, adding its line to the errors while
+// preserving their exit codes
+func (s *drawStep) run(d device.Drawer) error {
+	if err := s.cmd.run(d, s.args); err != nil {
+		return &exitError{code: exitCode(err), err: fmt.Errorf("line %d: %s: %v", s.line, s.cmd.name, err)}
+	}
+	return nil
+}
+
+func findDrawCommand(name string) *drawCommand {
+	for _, c := range drawCommands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseDrawArg parses an argument of a drawing command. Colors are
+// given by name, everything else is an integer. Widths and heights
+// can't be negative.
+func parseDrawArg(kind string, s string) (int, error) {
+	if kind == "color" {
+		c, ok := colorNames[strings.ToLower(s)]
+		if !ok {
+			return 0, fmt.Errorf("invalid color %q, must be black, transparent, white or gray", s)
+		}
+		return int(c), nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", kind, s)
+	}
+	if v < 0 && (kind == "width" || kind == "height") {
+		return 0, fmt.Errorf("%s can't be negative", kind)
+	}
+	return v, nil
+}
+
+// parseDrawScript parses a whole drawing script, so errors are
+// reported before anything is drawn
+func parseDrawScript(r io.Reader) ([]*drawStep, error) {
+	var steps []*drawStep
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		cmd := findDrawCommand(strings.ToLower(fields[0]))
+		if cmd == nil {
+			return nil, fmt.Errorf("line %d: unknown command %q", line, fields[0])
+		}
+		if len(fields)-1 != len(cmd.args) {
+			return nil, fmt.Errorf("line %d: %s takes %d arguments (%s), got %d",
+				line, cmd.name, len(cmd.args), strings.Join(cmd.args, " "), len(fields)-1)
+		}
+		step := &drawStep{line: line, cmd: cmd, args: make([]int, len(cmd.args))}
+		for ii, kind := range cmd.args {
+			v, err := parseDrawArg(kind, fields[ii+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			step.args[ii] = v
+		}
+		steps = append(steps, step)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+type drawResult struct {
+	Commands int `json:"commands"`
+}
+
+func (r *drawResult) String() string {
+	return fmt.Sprintf("Ran %d drawing commands", r.Commands)
+}
+
+func runDraw(e *env) (interface{}, error) {
+	data, err := readInput(e.args[0])
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseDrawScript(bytes.NewReader(data))
+	if err != nil {
+		return nil, usageError("%s: %v", e.args[0], err)
+	}
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range steps {
+		if err := s.run(dev); err != nil {
+			return nil, err
+		}
+	}
+	return &drawResult{Commands: len(steps)}, nil
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDrawScriptErrors(t *testing.T) {
+	cases := map[string]string{
+		"move 1":              "line 1: move takes 2 arguments (x y), got 1",
+		"\n\njump 1 2":        `line 3: unknown command "jump"`,
+		"fill-color pink":     `line 1: invalid color "pink"`,
+		"fill-rect 0 0 -1 2":  "line 1: width can't be negative",
+		"stroke-width thick":  `line 1: invalid width "thick"`,
+		"clear\nline 1 2 3":   "line 2: line takes 2 arguments",
+		"begin\n  # comment ": "",
+	}
+	for script, expected := range cases {
+		steps, err := parseDrawScript(strings.NewReader(script))
+		if expected == "" {
+			assert.NoError(t, err, script)
+			assert.Len(t, steps, 1)
+			continue
+		}
+		if assert.Error(t, err, script) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
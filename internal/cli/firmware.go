@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"osdapp/firmware"
+	"osdapp/frskyosd"
+)
+
+type firmwareEntry struct {
+	Version  string `json:"version"`
+	Beta     bool   `json:"beta"`
+	Date     string `json:"date,omitempty"`
+	Filename string `json:"filename"`
+	Source   string `json:"source"`
+	URL      string `json:"url"`
+}
+
+type firmwareListResult struct {
+	Firmwares []*firmwareEntry `json:"firmwares"`
+}
+
+func (r *firmwareListResult) String() string {
+	lines := make([]string, len(r.Firmwares))
+	for ii, f := range r.Firmwares {
+		lines[ii] = fmt.Sprintf("%-16s %-10s %s", f.Version, f.Date, f.Filename)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// firmwareSources returns the configured firmware sources
+func (e *env) firmwareSources() ([]firmware.Source, error) {
+	if e.opts.FirmwareSources != nil {
+		return e.opts.FirmwareSources()
+	}
+	return firmware.DefaultSources(), nil
+}
+
+// loadFirmwares returns the firmwares available in the configured
+// sources and in the cache
+func (e *env) loadFirmwares() ([]*firmware.Firmware, error) {
+	sources, err := e.firmwareSources()
+	if err != nil {
+		return nil, err
+	}
+	if e.opts.FirmwareCache != nil {
+		sources = append(sources, e.opts.FirmwareCache)
+	}
+	return firmware.LoadFrom(e.ctx, sources)
+}
+
+// loadFirmwareFile returns the firmware given by spec. See
+// firmware.Resolve.
+func (e *env) loadFirmwareFile(spec string) (*firmware.File, *firmware.Firmware, error) {
+	sources, err := e.firmwareSources()
+	if err != nil {
+		return nil, nil, err
+	}
+	fw, f, err := firmware.Resolve(e.ctx, spec, sources, e.opts.FirmwareCache, e.beta)
+	if se, ok := err.(*firmware.SpecError); ok {
+		return nil, nil, &exitError{code: ExitUsage, err: se}
+	}
+	return fw, f, err
+}
+
+func runFirmwareList(e *env) (interface{}, error) {
+	firmwares, err := e.loadFirmwares()
+	if err != nil {
+		return nil, err
+	}
+	r := &firmwareListResult{Firmwares: make([]*firmwareEntry, 0, len(firmwares))}
+	for _, f := range firmwares {
+		v, err := f.Version()
+		if err != nil {
+			continue
+		}
+		filename, _ := f.Filename()
+		entry := &firmwareEntry{
+			Version:  v.String(),
+			Beta:     v.IsBeta(),
+			Filename: filename,
+			Source:   f.Source,
+			URL:      f.URL,
+		}
+		if date, err := f.Date(); err == nil {
+			entry.Date = date.Format("2006-01-02")
+		}
+		r.Firmwares = append(r.Firmwares, entry)
+	}
+	return r, nil
+}
+
+type firmwareFlashResult struct {
+	File            string `json:"file"`
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+}
+
+func (r *firmwareFlashResult) String() string {
+	if r.FirmwareVersion == "" {
+		return fmt.Sprintf("Flashed %s", r.File)
+	}
+	return fmt.Sprintf("Flashed %s, OSD is running firmware %s", r.File, r.FirmwareVersion)
+}
+
+func setupFirmwareFlash(fs *flag.FlagSet, e *env) {
+	fs.BoolVar(&e.force, "force", false, "Flash the firmware even if it doesn't look valid")
+	fs.BoolVar(&e.beta, "beta", false, "Consider beta firmwares for latest")
+}
+
+func runFirmwareFlash(e *env) (interface{}, error) {
+	fw, f, err := e.loadFirmwareFile(e.args[0])
+	if err != nil {
+		return nil, err
+	}
+	img, err := firmware.ParseImage(fw.Data)
+	if err == nil && f != nil {
+		err = img.CheckVersion(f)
+	}
+	if err != nil {
+		if _, ok := err.(*firmware.ImageError); !ok || !e.force {
+			if ok {
+				err = fmt.Errorf("%v, use -force to flash it anyway", err)
+			}
+			return nil, err
+		}
+		fmt.Fprintf(e.stderr, "warning: %v\n", err)
+	}
+	if err := e.flash(bytes.NewReader(fw.Data)); err != nil {
+		return nil, err
+	}
+	res := &firmwareFlashResult{File: fw.Name}
+	info, err := e.dev.Info()
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsBootloader {
+		res.FirmwareVersion = info.FirmwareVersion().String()
+	}
+	return res, nil
+}
+
+type firmwareEraseResult struct {
+	Erased bool `json:"erased"`
+}
+
+func (r *firmwareEraseResult) String() string {
+	return "Firmware erased, the OSD is in bootloader mode"
+}
+
+func runFirmwareErase(e *env) (interface{}, error) {
+	if err := e.flash(nil); err != nil {
+		return nil, err
+	}
+	return &firmwareEraseResult{Erased: true}, nil
+}
+
+// flash flashes the given firmware or erases it if r is nil
+func (e *env) flash(r io.Reader) error {
+	dev, err := e.connect()
+	if err != nil {
+		return err
+	}
+	err = dev.FlashFirmwareWithOptions(e.ctx, r, &frskyosd.FlashOptions{
+		Validate: firmware.Validate,
+		Force:    e.force,
+		Progress: func(p *frskyosd.FlashProgress) {
+			e.progress("%s", p)
+		},
+	})
+	e.progressDone()
+	if err == context.Canceled {
+		return errors.New("flashing cancelled, the OSD was left in bootloader mode")
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/fiam/max7456tool/mcm"
+
+	"osdapp/fonts"
+	"osdapp/internal/atomicfile"
+)
+
+type fontUploadResult struct {
+	File     string   `json:"file"`
+	Chars    int      `json:"chars"`
+	Warnings []string `json:"warnings"`
+}
+
+func (r *fontUploadResult) String() string {
+	return fmt.Sprintf("Uploaded %d characters from %s", r.Chars, r.File)
+}
+
+func setupFontUpload(fs *flag.FlagSet, e *env) {
+	fs.BoolVar(&e.force, "force", false, "Upload the font even if it has errors")
+	fs.StringVar(&e.symbols, "symbols", "", "Check the font against the symbols used by a firmware (INAV or Betaflight)")
+}
+
+func runFontUpload(e *env) (interface{}, error) {
+	var symbols *fonts.SymbolMap
+	if e.symbols != "" {
+		for _, m := range fonts.SymbolMaps() {
+			if strings.EqualFold(m.Name, e.symbols) {
+				symbols = m
+			}
+		}
+		if symbols == nil {
+			return nil, usageError("unknown firmware %q for -symbols", e.symbols)
+		}
+	}
+	filename := e.args[0]
+	data, err := readInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := mcm.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	issues := fonts.Lint(dec, symbols)
+	warnings := make([]string, 0, len(issues))
+	for _, v := range issues {
+		warnings = append(warnings, v.String())
+		fmt.Fprintf(e.stderr, "%s: %s\n", filename, v)
+	}
+	if fonts.LintHasErrors(issues) && !e.force {
+		return nil, fmt.Errorf("%s has errors, use -force to upload it anyway", filename)
+	}
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	err = dev.UploadFont(bytes.NewReader(data), func(done, total int) {
+		e.progress("Writing font (%03d/%03d)...", done, total)
+	})
+	e.progressDone()
+	if err != nil {
+		return nil, err
+	}
+	return &fontUploadResult{File: filename, Chars: dec.NChars(), Warnings: warnings}, nil
+}
+
+// readFont reads all the characters from the OSD
+func (e *env) readFont() ([]*mcm.Char, error) {
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	chars := make([]*mcm.Char, mcm.ExtendedCharNum)
+	for ii := range chars {
+		msg, err := dev.ReadFontChar(uint(ii))
+		if err != nil {
+			e.progressDone()
+			return nil, err
+		}
+		e.progress("Reading font (%03d/%03d)...", ii+1, len(chars))
+		data := make([]byte, 0, mcm.CharBytes)
+		data = append(data, msg.Data[:]...)
+		data = append(data, msg.Metadata[:]...)
+		if chars[ii], err = mcm.NewCharFromData(data); err != nil {
+			e.progressDone()
+			return nil, err
+		}
+	}
+	e.progressDone()
+	return chars, nil
+}
+
+type fontDownloadResult struct {
+	File  string `json:"file"`
+	Chars int    `json:"chars"`
+}
+
+func (r *fontDownloadResult) String() string {
+	return fmt.Sprintf("Saved %d characters to %s", r.Chars, r.File)
+}
+
+func runFontDownload(e *env) (interface{}, error) {
+	chars, err := e.readFont()
+	if err != nil {
+		return nil, err
+	}
+	enc := &mcm.Encoder{Chars: make(map[int]*mcm.Char, len(chars))}
+	for ii, c := range chars {
+		enc.Chars[ii] = c
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf); err != nil {
+		return nil, err
+	}
+	filename := e.args[0]
+	if filename == "-" {
+		// The font itself is the result
+		_, err := e.stdout.Write(buf.Bytes())
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return &fontDownloadResult{File: filename, Chars: len(chars)}, nil
+}
+
+type fontVerifyResult struct {
+	File        string   `json:"file"`
+	Match       bool     `json:"match"`
+	Differences []string `json:"differences"`
+}
+
+func (r *fontVerifyResult) String() string {
+	if r.Match {
+		return fmt.Sprintf("Font in the OSD matches %s", r.File)
+	}
+	return fmt.Sprintf("Font in the OSD differs from %s in characters %s", r.File, strings.Join(r.Differences, ", "))
+}
+
+func runFontVerify(e *env) (interface{}, error) {
+	filename := e.args[0]
+	data, err := readInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := mcm.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	chars, err := e.readFont()
+	if err != nil {
+		return nil, err
+	}
+	installed := make([][]byte, len(chars))
+	for ii, c := range chars {
+		installed[ii] = c.Data()
+	}
+	fp, err := fonts.NewFingerprint(installed)
+	if err != nil {
+		return nil, err
+	}
+	diff := fp.Diff(fonts.FingerprintFont(dec))
+	r := &fontVerifyResult{File: filename, Match: len(diff) == 0, Differences: make([]string, len(diff))}
+	for ii, v := range diff {
+		r.Differences[ii] = v.String()
+	}
+	if !r.Match {
+		return r, &exitError{code: ExitMismatch, err: errors.New("font doesn't match")}
+	}
+	return r, nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"osdapp/internal/device"
+	"osdapp/internal/provision"
+)
+
+type provisionResult struct {
+	provision.Summary
+	Report  string              `json:"report,omitempty"`
+	Results []*provision.Result `json:"results"`
+}
+
+func (r *provisionResult) String() string {
+	var lines []string
+	for _, res := range r.Results {
+		status := "passed"
+		if !res.Passed {
+			status = "FAILED: " + res.Error
+		}
+		lines = append(lines, fmt.Sprintf("%-20s %s", res.Port, status))
+	}
+	lines = append(lines, fmt.Sprintf("%d passed, %d failed", r.Passed, r.Failed))
+	if r.Report != "" {
+		lines = append(lines, "Report saved to "+r.Report)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func setupProvision(fs *flag.FlagSet, e *env) {
+	fs.StringVar(&e.report, "report", "", "Save a report to this file, as CSV if it ends with .csv and as JSON otherwise")
+	fs.StringVar(&e.ports, "ports", "", "Comma separated ports to provision, all the available ones by default")
+	fs.IntVar(&e.parallel, "parallel", 0, "Maximum number of OSDs to provision at the same time, 0 for no limit")
+}
+
+func runProvision(e *env) (interface{}, error) {
+	m, err := provision.LoadManifest(e.args[0])
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, &exitError{code: ExitUsage, err: err}
+	}
+	sources, err := e.firmwareSources()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := provision.Prepare(e.ctx, m, sources, e.opts.FirmwareCache)
+	if err != nil {
+		return nil, err
+	}
+	var ports []string
+	if e.ports != "" {
+		for _, p := range strings.Split(e.ports, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				ports = append(ports, p)
+			}
+		}
+	} else if e.port != "" {
+		ports = []string{e.port}
+	} else {
+		if ports, err = device.AvailablePorts(); err != nil {
+			return nil, &exitError{code: ExitNoDevice, err: err}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, &exitError{code: ExitNoDevice, err: errors.New("no ports found")}
+	}
+	// Print a line each time a port changes its stage, without
+	// the counters, since several ports report at the same time.
+	var mu sync.Mutex
+	stages := make(map[string]string)
+	results, err := plan.Run(e.ctx, &provision.Options{
+		Ports:    ports,
+		Parallel: e.parallel,
+		Progress: func(port string, status string) {
+			stage := status
+			if idx := strings.IndexAny(status, "(0123456789"); idx > 0 {
+				stage = strings.TrimSpace(status[:idx])
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stages[port] != stage {
+				stages[port] = stage
+				fmt.Fprintf(e.stderr, "%s: %s\n", port, status)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &provisionResult{Summary: provision.Summarize(results), Results: results}
+	if e.report != "" {
+		if err := provision.WriteReport(e.report, results); err != nil {
+			return r, err
+		}
+		r.Report = e.report
+	}
+	if r.Failed > 0 {
+		return r, fmt.Errorf("%d of %d OSDs failed", r.Failed, len(results))
+	}
+	return r, nil
+}
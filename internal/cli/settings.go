@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"osdapp/frskyosd"
+)
+
+// settingNames lists the names accepted by settings set, in
+// the order they're displayed
+var settingNames = []string{"brightness", "horizontal_offset", "vertical_offset"}
+
+type settingsResult struct {
+	Brightness       int  `json:"brightness"`
+	HorizontalOffset int  `json:"horizontal_offset"`
+	VerticalOffset   int  `json:"vertical_offset"`
+	Saved            bool `json:"saved"`
+}
+
+func newSettingsResult(s *frskyosd.SettingsMessage) *settingsResult {
+	return &settingsResult{
+		Brightness:       int(s.Brightness),
+		HorizontalOffset: int(s.HorizontalOffset),
+		VerticalOffset:   int(s.VerticalOffset),
+	}
+}
+
+func (r *settingsResult) String() string {
+	s := fmt.Sprintf("brightness=%d\nhorizontal_offset=%d\nvertical_offset=%d", r.Brightness, r.HorizontalOffset, r.VerticalOffset)
+	if r.Saved {
+		s += "\nSettings saved"
+	}
+	return s
+}
+
+// settingField returns a pointer to the field for the given setting
+func settingField(s *frskyosd.SettingsMessage, name string) *int8 {
+	switch strings.Replace(strings.ToLower(name), "-", "_", -1) {
+	case "brightness":
+		return &s.Brightness
+	case "horizontal_offset":
+		return &s.HorizontalOffset
+	case "vertical_offset":
+		return &s.VerticalOffset
+	}
+	return nil
+}
+
+// applySettings applies assignments like brightness=10 to s
+func applySettings(s *frskyosd.SettingsMessage, assignments []string) error {
+	for _, a := range assignments {
+		sep := strings.IndexByte(a, '=')
+		if sep < 0 {
+			return usageError("invalid setting %q, must be <name>=<value>", a)
+		}
+		name := a[:sep]
+		field := settingField(s, name)
+		if field == nil {
+			return usageError("unknown setting %q, valid ones are %s", name, strings.Join(settingNames, ", "))
+		}
+		val, err := strconv.Atoi(a[sep+1:])
+		if err != nil || val < math.MinInt8 || val > math.MaxInt8 {
+			return usageError("invalid value %q for %s, must be between %d and %d", a[sep+1:], name, math.MinInt8, math.MaxInt8)
+		}
+		*field = int8(val)
+	}
+	return nil
+}
+
+func runSettingsGet(e *env) (interface{}, error) {
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := dev.ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return newSettingsResult(settings), nil
+}
+
+// changeSettings reads the settings, calls change on them and
+// writes them back, returning the values accepted by the OSD
+func (e *env) changeSettings(change func(s *frskyosd.SettingsMessage) error) (interface{}, error) {
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := dev.ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+	if err := change(settings); err != nil {
+		return nil, err
+	}
+	updated, err := dev.SetSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	return newSettingsResult(updated), nil
+}
+
+func runSettingsSet(e *env) (interface{}, error) {
+	// Check the arguments before connecting
+	if err := applySettings(&frskyosd.SettingsMessage{}, e.args); err != nil {
+		return nil, err
+	}
+	return e.changeSettings(func(s *frskyosd.SettingsMessage) error {
+		return applySettings(s, e.args)
+	})
+}
+
+func runSettingsReset(e *env) (interface{}, error) {
+	return e.changeSettings(func(s *frskyosd.SettingsMessage) error {
+		s.RestoreDefaults()
+		return nil
+	})
+}
+
+func runSettingsSave(e *env) (interface{}, error) {
+	dev, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	if err := dev.SaveSettings(); err != nil {
+		return nil, err
+	}
+	settings, err := dev.ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+	r := newSettingsResult(settings)
+	r.Saved = true
+	return r, nil
+}
@@ -0,0 +1,49 @@
+// Package device abstracts the connection to an OSD, so the code
+// talking to OSDs can be tested without one.
+package device
+
+import (
+	"context"
+	"io"
+
+	"osdapp/frskyosd"
+)
+
+// Drawer contains the drawing methods of *frskyosd.OSD
+type Drawer interface {
+	TransactionBegin() error
+	TransactionCommit() error
+	TransactionBeginResettingDrawing() error
+	SetStrokeColor(c frskyosd.Color) error
+	SetFillColor(c frskyosd.Color) error
+	SetStrokeWidth(w int) error
+	ClearScreen() error
+	ResetDrawing() error
+	MoveToPoint(x int, y int) error
+	StrokeLineToPoint(x int, y int) error
+	FillRect(x int, y int, w uint, h uint) error
+}
+
+// Device contains the methods of *frskyosd.OSD used by the
+// headless commands and by provisioning.
+type Device interface {
+	Drawer
+	Info() (*frskyosd.InfoMessage, error)
+	Capabilities() (*frskyosd.Capabilities, error)
+	ReadFontChar(idx uint) (*frskyosd.FontCharMessage, error)
+	UploadFont(r io.Reader, progress func(done int, total int)) error
+	ReadSettings() (*frskyosd.SettingsMessage, error)
+	SetSettings(settings *frskyosd.SettingsMessage) (*frskyosd.SettingsMessage, error)
+	SaveSettings() error
+	FlashFirmwareWithOptions(ctx context.Context, r io.Reader, opts *frskyosd.FlashOptions) error
+	Close() error
+}
+
+var (
+	// AvailablePorts returns the ports OSDs might be connected
+	// to. Overridden by tests, see devicetest.WithDevices.
+	AvailablePorts = frskyosd.AvailablePorts
+	// Open connects to the OSD at the given port. Overridden
+	// by tests, see devicetest.WithDevices.
+	Open = func(port string) (Device, error) { return frskyosd.New(port) }
+)
@@ -0,0 +1,219 @@
+// Package devicetest implements a fake device.Device for tests
+package devicetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/fiam/max7456tool/mcm"
+
+	"osdapp/frskyosd"
+	"osdapp/internal/device"
+	"osdapp/internal/osdversion"
+)
+
+// Fake is an in-memory device.Device. Operations that need a
+// firmware fail with frskyosd.ErrUnsupported in bootloader mode.
+type Fake struct {
+	Version osdversion.Version
+	// FlashedVersion is the version the OSD runs after flashing
+	// any firmware
+	FlashedVersion osdversion.Version
+	Bootloader     bool
+	Font           [mcm.ExtendedCharNum][]byte
+	// Corrupt, if >= 0, is a character that's not stored
+	// when uploading fonts
+	Corrupt  int
+	Settings frskyosd.SettingsMessage
+	Saved    bool
+	Flashed  []byte
+	Erased   bool
+	// Calls contains the drawing operations, in order
+	Calls  []string
+	Closed bool
+}
+
+// NewFake returns a *Fake running the given firmware version,
+// which it keeps after flashing
+func NewFake(version string) *Fake {
+	v := osdversion.MustParse(version)
+	d := &Fake{Version: v, FlashedVersion: v, Corrupt: -1}
+	for ii := range d.Font {
+		d.Font[ii] = bytes.Repeat([]byte{0x55}, mcm.CharBytes)
+	}
+	return d
+}
+
+// Info implements device.Device
+func (d *Fake) Info() (*frskyosd.InfoMessage, error) {
+	info := &frskyosd.InfoMessage{IsBootloader: d.Bootloader}
+	if !d.Bootloader {
+		info.Version.Major = uint8(d.Version.Major)
+		info.Version.Minor = uint8(d.Version.Minor)
+		info.Version.Patch = uint8(d.Version.Patch)
+		info.TVStandard = frskyosd.TVStandardPAL
+		info.Grid.Rows = 16
+		info.Grid.Columns = 30
+		info.Pixels.Width = 360
+		info.Pixels.Height = 288
+		info.MaxFrameSize = 64
+	}
+	return info, nil
+}
+
+// Capabilities implements device.Device
+func (d *Fake) Capabilities() (*frskyosd.Capabilities, error) {
+	info, _ := d.Info()
+	return frskyosd.NewCapabilities(info), nil
+}
+
+// ReadFontChar implements device.Device
+func (d *Fake) ReadFontChar(idx uint) (*frskyosd.FontCharMessage, error) {
+	if d.Bootloader {
+		return nil, frskyosd.ErrUnsupported
+	}
+	msg := &frskyosd.FontCharMessage{Addr: uint16(idx)}
+	copy(msg.Data[:], d.Font[idx])
+	copy(msg.Metadata[:], d.Font[idx][len(msg.Data):])
+	return msg, nil
+}
+
+// UploadFont implements device.Device
+func (d *Fake) UploadFont(r io.Reader, progress func(done int, total int)) error {
+	if d.Bootloader {
+		return frskyosd.ErrUnsupported
+	}
+	dec, err := mcm.NewDecoder(r)
+	if err != nil {
+		return err
+	}
+	for ii := 0; ii < dec.NChars(); ii++ {
+		if ii != d.Corrupt {
+			d.Font[ii] = dec.CharAt(ii).Data()
+		}
+	}
+	return nil
+}
+
+// ReadSettings implements device.Device
+func (d *Fake) ReadSettings() (*frskyosd.SettingsMessage, error) {
+	if d.Bootloader {
+		return nil, frskyosd.ErrUnsupported
+	}
+	s := d.Settings
+	return &s, nil
+}
+
+// SetSettings implements device.Device. Brightness is limited
+// to 50, to emulate an OSD that adjusts the settings.
+func (d *Fake) SetSettings(settings *frskyosd.SettingsMessage) (*frskyosd.SettingsMessage, error) {
+	d.Settings = *settings
+	if d.Settings.Brightness > 50 {
+		d.Settings.Brightness = 50
+	}
+	return d.ReadSettings()
+}
+
+// SaveSettings implements device.Device
+func (d *Fake) SaveSettings() error {
+	d.Saved = true
+	return nil
+}
+
+// FlashFirmwareWithOptions implements device.Device
+func (d *Fake) FlashFirmwareWithOptions(ctx context.Context, r io.Reader, opts *frskyosd.FlashOptions) error {
+	if r == nil {
+		d.Erased = true
+		d.Bootloader = true
+		return nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if opts != nil && opts.Validate != nil && !opts.Force {
+		if err := opts.Validate(data); err != nil {
+			return err
+		}
+	}
+	d.Flashed = data
+	d.Bootloader = false
+	d.Version = d.FlashedVersion
+	return nil
+}
+
+// Close implements device.Device
+func (d *Fake) Close() error {
+	d.Closed = true
+	return nil
+}
+
+func (d *Fake) record(format string, args ...interface{}) error {
+	if d.Bootloader {
+		return frskyosd.ErrUnsupported
+	}
+	d.Calls = append(d.Calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// TransactionBegin implements device.Drawer
+func (d *Fake) TransactionBegin() error { return d.record("begin") }
+
+// TransactionCommit implements device.Drawer
+func (d *Fake) TransactionCommit() error { return d.record("commit") }
+
+// TransactionBeginResettingDrawing implements device.Drawer
+func (d *Fake) TransactionBeginResettingDrawing() error { return d.record("begin-reset") }
+
+// SetStrokeColor implements device.Drawer
+func (d *Fake) SetStrokeColor(c frskyosd.Color) error { return d.record("stroke-color %d", c) }
+
+// SetFillColor implements device.Drawer
+func (d *Fake) SetFillColor(c frskyosd.Color) error { return d.record("fill-color %d", c) }
+
+// SetStrokeWidth implements device.Drawer
+func (d *Fake) SetStrokeWidth(w int) error { return d.record("stroke-width %d", w) }
+
+// ClearScreen implements device.Drawer
+func (d *Fake) ClearScreen() error { return d.record("clear") }
+
+// ResetDrawing implements device.Drawer
+func (d *Fake) ResetDrawing() error { return d.record("reset") }
+
+// MoveToPoint implements device.Drawer
+func (d *Fake) MoveToPoint(x int, y int) error { return d.record("move %d %d", x, y) }
+
+// StrokeLineToPoint implements device.Drawer
+func (d *Fake) StrokeLineToPoint(x int, y int) error { return d.record("line %d %d", x, y) }
+
+// FillRect implements device.Drawer
+func (d *Fake) FillRect(x int, y int, w uint, h uint) error {
+	return d.record("fill-rect %d %d %d %d", x, y, w, h)
+}
+
+// WithDevices makes device.AvailablePorts and device.Open see
+// the given devices, keyed by port name. Call the returned
+// function to restore them.
+func WithDevices(devices map[string]*Fake) func() {
+	prevPorts, prevOpen := device.AvailablePorts, device.Open
+	device.AvailablePorts = func() ([]string, error) {
+		var ports []string
+		for k := range devices {
+			ports = append(ports, k)
+		}
+		return ports, nil
+	}
+	device.Open = func(port string) (device.Device, error) {
+		if d := devices[port]; d != nil {
+			return d, nil
+		}
+		return nil, errors.New("no such port")
+	}
+	return func() {
+		device.AvailablePorts, device.Open = prevPorts, prevOpen
+	}
+}
@@ -2,6 +2,7 @@ package dialog
 
 import (
 	"fyne.io/fyne"
+	"fyne.io/fyne/layout"
 	"fyne.io/fyne/theme"
 	"fyne.io/fyne/widget"
 )
@@ -10,7 +11,8 @@ import (
 type ProgressDialog struct {
 	*dialog
 
-	bar *widget.ProgressBar
+	bar    *widget.ProgressBar
+	cancel *widget.Button
 }
 
 // SetValue updates the value of the progress bar - this should be between 0.0 and 1.0.
@@ -18,6 +20,12 @@ func (p *ProgressDialog) SetValue(v float64) {
 	p.bar.SetValue(v)
 }
 
+// UpdateMessage changes the text displayed above the progress bar
+func (p *ProgressDialog) UpdateMessage(message string) {
+	label := p.content.(*widget.Label)
+	label.SetText(message)
+}
+
 // NewProgress creates a progress dialog and returns the handle.
 // Using the returned type you should call Show() and then set its value through SetValue().
 func NewProgress(title, message string, parent fyne.Window) *ProgressDialog {
@@ -26,5 +34,27 @@ func NewProgress(title, message string, parent fyne.Window) *ProgressDialog {
 	bar.Resize(fyne.NewSize(200, bar.MinSize().Height))
 
 	d.setButtons(bar)
-	return &ProgressDialog{d, bar}
+	return &ProgressDialog{dialog: d, bar: bar}
+}
+
+// NewProgressWithCancel creates a progress dialog with a cancel button.
+// When the button is tapped, it's disabled and onCancel is called. The
+// dialog isn't hidden, the caller should call Hide() once the operation
+// has been stopped.
+func NewProgressWithCancel(title, message string, onCancel func(), parent fyne.Window) *ProgressDialog {
+	d := newDialog(title, message, theme.InfoIcon(), nil, parent)
+	bar := widget.NewProgressBar()
+	bar.Resize(fyne.NewSize(200, bar.MinSize().Height))
+	p := &ProgressDialog{dialog: d, bar: bar}
+	p.cancel = widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		p.cancel.Disable()
+		if onCancel != nil {
+			onCancel()
+		}
+	})
+	d.setButtons(widget.NewVBox(
+		bar,
+		widget.NewHBox(layout.NewSpacer(), p.cancel, layout.NewSpacer()),
+	))
+	return p
 }
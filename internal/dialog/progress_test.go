@@ -0,0 +1,34 @@
+package dialog
+
+import (
+	"testing"
+
+	"fyne.io/fyne/test"
+	"fyne.io/fyne/widget"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressDialog_UpdateMessage(t *testing.T) {
+	d := NewProgress("title", "message", test.NewWindow(nil))
+
+	d.UpdateMessage("updated")
+
+	assert.Equal(t, "updated", d.content.(*widget.Label).Text)
+}
+
+func TestProgressDialog_Cancel(t *testing.T) {
+	cancelled := 0
+	d := NewProgressWithCancel("title", "message", func() {
+		cancelled++
+	}, test.NewWindow(nil))
+
+	d.Show()
+	test.Tap(d.cancel)
+
+	assert.Equal(t, 1, cancelled)
+	assert.True(t, d.cancel.Disabled())
+	assert.False(t, d.win.Hidden)
+
+	d.Hide()
+	assert.True(t, d.win.Hidden)
+}
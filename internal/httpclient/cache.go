@@ -0,0 +1,221 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// maxCacheSize is the maximum size of a cached response
+	maxCacheSize = 4 * 1024 * 1024
+
+	// FromCacheHeader is set in responses served from the cache
+	// without contacting the server
+	FromCacheHeader = "X-From-Cache"
+)
+
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+type cacheStore interface {
+	Get(key string) *cacheEntry
+	Put(key string, entry *cacheEntry) error
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]*cacheEntry)}
+}
+
+func (c *memoryCache) Get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *memoryCache) Put(key string, entry *cacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	return nil
+}
+
+// diskCache stores each entry as a JSON file in dir
+type diskCache struct {
+	dir string
+}
+
+func (c *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *diskCache) Get(key string) *cacheEntry {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("ignoring invalid HTTP cache entry: %v", err)
+		return nil
+	}
+	return &entry
+}
+
+func (c *diskCache) Put(key string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.dir, ".entry-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// cacheTransport caches the responses with an ETag or a Last-Modified
+// header and revalidates them with conditional requests. When the
+// server replies with 304 Not Modified, the cached response is
+// returned. GitHub doesn't count these against the rate limit.
+// Cached responses are also used when the network is unavailable.
+type cacheTransport struct {
+	base    http.RoundTripper
+	store   cacheStore
+	offline bool
+}
+
+func cacheKey(req *http.Request) string {
+	return req.URL.String() + " " + req.Header.Get("Accept")
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+	key := cacheKey(req)
+	entry := t.store.Get(key)
+	if entry != nil && t.offline {
+		return entry.response(req, nil), nil
+	}
+	conditional := req
+	if entry != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		conditional = cloneRequest(req)
+		if entry.ETag != "" {
+			conditional.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			conditional.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(conditional)
+	if err != nil {
+		if entry != nil && req.Context().Err() == nil && err != context.Canceled {
+			log.Printf("serving %s from cache: %v", req.URL, err)
+			return entry.response(req, nil), nil
+		}
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil && conditional != req:
+		resp.Body.Close()
+		return entry.response(req, resp), nil
+	case resp.StatusCode == http.StatusOK:
+		etag := resp.Header.Get("ETag")
+		lastModified := resp.Header.Get("Last-Modified")
+		if (etag == "" && lastModified == "") || resp.ContentLength > maxCacheSize {
+			return resp, nil
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCacheSize+1))
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if len(body) > maxCacheSize {
+			// Too big to be cached, return it as is
+			resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return resp, nil
+		}
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		err = t.store.Put(key, &cacheEntry{
+			URL:          req.URL.String(),
+			ETag:         etag,
+			LastModified: lastModified,
+			Header:       resp.Header,
+			Body:         body,
+		})
+		if err != nil {
+			log.Printf("could not cache %s: %v", req.URL, err)
+		}
+	}
+	return resp, nil
+}
+
+// response returns an *http.Response for the cached entry. If
+// fresh is non-nil, it's the 304 response from the server and
+// its rate limit headers are kept.
+func (e *cacheEntry) response(req *http.Request, fresh *http.Response) *http.Response {
+	header := make(http.Header, len(e.Header)+1)
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	if fresh != nil {
+		for _, k := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+			if v := fresh.Header.Get(k); v != "" {
+				header.Set(k, v)
+			}
+		}
+	} else {
+		header.Set(FromCacheHeader, "1")
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,181 @@
+// Package httpclient provides the HTTP and GitHub clients shared by
+// the packages that access the network. It handles proxies, GitHub
+// tokens, timeouts, an offline mode and a response cache.
+package httpclient
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+const (
+	// DefaultTimeout is used when Config.Timeout is zero
+	DefaultTimeout = 30 * time.Second
+
+	gitHubAPIHost = "api.github.com"
+)
+
+// ErrOffline is returned for requests that need the network
+// while in offline mode
+var ErrOffline = errors.New("network access disabled in offline mode")
+
+// Config configures an HTTP client
+type Config struct {
+	// CacheDir is the directory where responses are cached. If
+	// empty, they're only cached in memory.
+	CacheDir string
+	// GitHubToken is sent with requests to the GitHub API, to
+	// raise the rate limit
+	GitHubToken string
+	// Proxy is the URL of the proxy to use. If empty, proxies
+	// are configured from the environment (HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY).
+	Proxy string
+	// Timeout limits the time to connect and to receive the
+	// response headers. Bodies can take longer.
+	Timeout time.Duration
+	// Offline disables network access. Requests are served
+	// from the cache when possible, failing with ErrOffline
+	// otherwise.
+	Offline bool
+}
+
+// ConfigFromEnvironment returns a Config with the token from
+// GITHUB_TOKEN, the proxy from FRSKY_OSD_PROXY and offline mode
+// enabled if FRSKY_OSD_OFFLINE is set.
+func ConfigFromEnvironment() *Config {
+	return &Config{
+		GitHubToken: os.Getenv("GITHUB_TOKEN"),
+		Proxy:       os.Getenv("FRSKY_OSD_PROXY"),
+		Offline:     os.Getenv("FRSKY_OSD_OFFLINE") != "",
+	}
+}
+
+var (
+	mu            sync.Mutex
+	defaultConfig *Config
+	defaultClient *http.Client
+)
+
+// Configure sets the Config used by Default. Clients returned
+// before calling Configure keep their previous settings.
+func Configure(cfg *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	c := *cfg
+	defaultConfig = &c
+	defaultClient = nil
+}
+
+// Default returns the shared client. If Configure hasn't been
+// called, it uses ConfigFromEnvironment.
+func Default() *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultClient == nil {
+		cfg := defaultConfig
+		if cfg == nil {
+			cfg = ConfigFromEnvironment()
+		}
+		defaultClient = New(cfg)
+	}
+	return defaultClient
+}
+
+// GitHub returns a GitHub API client using the shared client
+func GitHub() *github.Client {
+	return github.NewClient(Default())
+}
+
+// New returns a new *http.Client with the given configuration
+func New(cfg *Config) *http.Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		if u, err := url.Parse(cfg.Proxy); err == nil {
+			proxy = http.ProxyURL(u)
+		} else {
+			proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+		}
+	}
+	var base http.RoundTripper = &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if cfg.GitHubToken != "" {
+		base = &tokenTransport{base: base, host: gitHubAPIHost, token: cfg.GitHubToken}
+	}
+	if cfg.Offline {
+		base = offlineTransport{}
+	}
+	var store cacheStore = newMemoryCache()
+	if cfg.CacheDir != "" {
+		store = &diskCache{dir: cfg.CacheDir}
+	}
+	return &http.Client{Transport: &cacheTransport{base: base, store: store, offline: cfg.Offline}}
+}
+
+// IsOffline returns true iff err was caused by a request that
+// couldn't be served in offline mode
+func IsOffline(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	return err == ErrOffline
+}
+
+// tokenTransport authenticates the requests to host
+type tokenTransport struct {
+	base  http.RoundTripper
+	host  string
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(req.URL.Hostname(), t.host) || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	r := cloneRequest(req)
+	r.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, ErrOffline
+}
+
+// cloneRequest returns a shallow copy of req with a deep copy of its
+// headers, since RoundTrippers must not modify the request.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	return r
+}
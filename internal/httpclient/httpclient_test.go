@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	full        int
+	notModified int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		const etag = `"v1"`
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified++
+			w.Header().Set("X-RateLimit-Remaining", "59")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.full++
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, "content of %s", r.URL.Path)
+	}))
+	return s
+}
+
+func (s *testServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.full, s.notModified
+}
+
+func get(t *testing.T, c *http.Client, u string) (*http.Response, string, error) {
+	resp, err := c.Get(u)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data), nil
+}
+
+func testCacheDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestCache(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	dir, cleanup := testCacheDir(t)
+	defer cleanup()
+
+	c := New(&Config{CacheDir: dir})
+	for ii := 0; ii < 3; ii++ {
+		resp, body, err := get(t, c, srv.URL+"/a")
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "content of /a", body)
+		}
+	}
+	full, notModified := srv.counts()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 2, notModified)
+
+	// The cache must survive restarts
+	c = New(&Config{CacheDir: dir})
+	resp, body, err := get(t, c, srv.URL+"/a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "content of /a", body)
+		assert.Equal(t, "59", resp.Header.Get("X-RateLimit-Remaining"))
+	}
+	full, notModified = srv.counts()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 3, notModified)
+}
+
+func TestOffline(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	dir, cleanup := testCacheDir(t)
+	defer cleanup()
+
+	_, _, err := get(t, New(&Config{CacheDir: dir}), srv.URL+"/a")
+	assert.NoError(t, err)
+
+	c := New(&Config{CacheDir: dir, Offline: true})
+	resp, body, err := get(t, c, srv.URL+"/a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "content of /a", body)
+		assert.Equal(t, "1", resp.Header.Get(FromCacheHeader))
+	}
+	_, _, err = get(t, c, srv.URL+"/b")
+	assert.True(t, IsOffline(err), "error is %v", err)
+	full, notModified := srv.counts()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 0, notModified)
+
+	// Cached responses are used when the server is unreachable
+	srv.Close()
+	_, body, err = get(t, New(&Config{CacheDir: dir}), srv.URL+"/a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "content of /a", body)
+	}
+}
+
+func TestToken(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tr := &tokenTransport{base: http.DefaultTransport, host: u.Hostname(), token: "secret"}
+	c := &http.Client{Transport: tr}
+	_, _, err := get(t, c, srv.URL)
+	assert.NoError(t, err)
+
+	// Token must not be sent to other hosts
+	tr.host = "api.example.com"
+	_, _, err = get(t, c, srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token secret", ""}, auth)
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		fmt.Fprint(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	c := New(&Config{Proxy: proxy.URL})
+	_, body, err := get(t, c, "http://example.invalid/file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "proxied", body)
+	}
+	assert.Equal(t, []string{"http://example.invalid/file"}, proxied)
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	start := time.Now()
+	_, _, err := get(t, New(&Config{Timeout: 100 * time.Millisecond}), srv.URL)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
@@ -0,0 +1,261 @@
+// Package markdown implements a small Markdown parser covering
+// the subset used by release notes: headings, paragraphs, lists,
+// code blocks, rules and basic inline formatting.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Kind indicates the type of a Block
+type Kind int
+
+const (
+	// Paragraph is a block of regular text
+	Paragraph Kind = iota
+	// Heading is a heading, with its level in Block.Level
+	Heading
+	// ListItem is an item in a list, with its nesting depth
+	// (starting at zero) in Block.Level
+	ListItem
+	// Code is a fenced or indented code block
+	Code
+	// Rule is an horizontal rule
+	Rule
+)
+
+// Block represents a block level element in a document
+type Block struct {
+	Kind  Kind
+	Level int
+	// Text contains the raw Markdown text of the block, without
+	// its block level markers. Use Plain to remove the inline
+	// formatting.
+	Text string
+}
+
+var (
+	headingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	listRe    = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+(.*)$`)
+	ruleRe    = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	setextRe  = regexp.MustCompile(`^\s*(=+|-+)\s*$`)
+
+	linkRe   = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]*)(?:\s+"[^"]*")?\)`)
+	strongRe = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	emRe     = regexp.MustCompile(`(^|[^\w*])\*([^*\s][^*]*?)\*`)
+	codeRe   = regexp.MustCompile("`([^`]+)`")
+)
+
+// Parse splits the given Markdown document into blocks
+func Parse(src string) []*Block {
+	var blocks []*Block
+	var para []string
+	var code []string
+	inFence := false
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, &Block{Kind: Paragraph, Text: strings.Join(para, " ")})
+			para = nil
+		}
+	}
+	lines := strings.Split(strings.Replace(src, "\r\n", "\n", -1), "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			if inFence {
+				blocks = append(blocks, &Block{Kind: Code, Text: strings.Join(code, "\n")})
+				code = nil
+			} else {
+				flush()
+			}
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			code = append(code, line)
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if m := setextRe.FindStringSubmatch(line); m != nil && len(para) > 0 {
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			blocks = append(blocks, &Block{Kind: Heading, Level: level, Text: strings.Join(para, " ")})
+			para = nil
+			continue
+		}
+		if ruleRe.MatchString(line) {
+			flush()
+			blocks = append(blocks, &Block{Kind: Rule})
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			blocks = append(blocks, &Block{Kind: Heading, Level: len(m[1]), Text: m[2]})
+			continue
+		}
+		if m := listRe.FindStringSubmatch(line); m != nil {
+			flush()
+			indent := strings.Replace(m[1], "\t", "    ", -1)
+			blocks = append(blocks, &Block{Kind: ListItem, Level: len(indent) / 2, Text: m[2]})
+			continue
+		}
+		if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			if len(para) == 0 {
+				// Indented code block, unless it continues a list item
+				if n := len(blocks); n > 0 && blocks[n-1].Kind == ListItem {
+					blocks[n-1].Text += " " + trimmed
+				} else if n > 0 && blocks[n-1].Kind == Code && blocks[n-1].Level == 1 {
+					blocks[n-1].Text += "\n" + trimIndent(line)
+				} else {
+					blocks = append(blocks, &Block{Kind: Code, Level: 1, Text: trimIndent(line)})
+				}
+				continue
+			}
+		}
+		if n := len(blocks); len(para) == 0 && n > 0 && blocks[n-1].Kind == ListItem && line != trimmed {
+			// Lazy continuation of a list item
+			blocks[n-1].Text += " " + trimmed
+			continue
+		}
+		para = append(para, trimmed)
+	}
+	if inFence {
+		blocks = append(blocks, &Block{Kind: Code, Text: strings.Join(code, "\n")})
+	}
+	flush()
+	for _, b := range blocks {
+		if b.Kind == Code {
+			// Level is only used internally to track indented blocks
+			b.Level = 0
+		}
+	}
+	return blocks
+}
+
+func trimIndent(line string) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	return line[4:]
+}
+
+// Plain returns the text of the block without its inline formatting.
+// Links are replaced by their text.
+func (b *Block) Plain() string {
+	if b.Kind == Code {
+		return b.Text
+	}
+	return Plain(b.Text)
+}
+
+// Plain removes the inline formatting from the given text
+func Plain(s string) string {
+	s = linkRe.ReplaceAllString(s, "$1")
+	s = strongRe.ReplaceAllString(s, "$1$2")
+	s = emRe.ReplaceAllString(s, "$1$2")
+	s = codeRe.ReplaceAllString(s, "$1")
+	return s
+}
+
+// inlineHTML converts the inline formatting in s to HTML
+func inlineHTML(s string) string {
+	s = html.EscapeString(s)
+	s = codeRe.ReplaceAllString(s, "<code>$1</code>")
+	s = linkRe.ReplaceAllStringFunc(s, linkHTML)
+	s = strongRe.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = emRe.ReplaceAllString(s, "$1<em>$2</em>")
+	return s
+}
+
+// linkHTML converts an escaped Markdown link to HTML. Links
+// with targets other than http, https or relative URLs are
+// replaced by their text.
+func linkHTML(link string) string {
+	m := linkRe.FindStringSubmatch(link)
+	if !isSafeURL(html.UnescapeString(m[2])) {
+		return m[1]
+	}
+	return `<a href="` + m[2] + `">` + m[1] + `</a>`
+}
+
+func isSafeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https"
+}
+
+// HTML converts the given Markdown document to HTML
+func HTML(src string) string {
+	var sb strings.Builder
+	depth := -1
+	closeLists := func(level int) {
+		for ; depth > level; depth-- {
+			sb.WriteString("</li>\n</ul>\n")
+		}
+	}
+	for _, b := range Parse(src) {
+		if b.Kind != ListItem {
+			closeLists(-1)
+		}
+		switch b.Kind {
+		case Paragraph:
+			sb.WriteString("<p>" + inlineHTML(b.Text) + "</p>\n")
+		case Heading:
+			tag := string([]byte{'h', byte('0' + b.Level)})
+			sb.WriteString("<" + tag + ">" + inlineHTML(b.Text) + "</" + tag + ">\n")
+		case ListItem:
+			level := b.Level
+			if level > depth+1 {
+				level = depth + 1
+			}
+			switch {
+			case level > depth:
+				for ; depth < level; depth++ {
+					sb.WriteString("<ul>\n<li>")
+				}
+			default:
+				closeLists(level)
+				sb.WriteString("</li>\n<li>")
+			}
+			sb.WriteString(inlineHTML(b.Text))
+		case Code:
+			sb.WriteString("<pre><code>" + html.EscapeString(b.Text) + "</code></pre>\n")
+		case Rule:
+			sb.WriteString("<hr>\n")
+		}
+	}
+	closeLists(-1)
+	return sb.String()
+}
+
+// Wrap splits s into lines of at most width characters, breaking
+// at spaces. Words longer than width are kept in their own line.
+func Wrap(s string, width int) []string {
+	var lines []string
+	var cur []rune
+	for _, word := range strings.Fields(s) {
+		w := []rune(word)
+		if len(cur) > 0 && len(cur)+1+len(w) > width {
+			lines = append(lines, string(cur))
+			cur = nil
+		}
+		if len(cur) > 0 {
+			cur = append(cur, ' ')
+		}
+		cur = append(cur, w...)
+	}
+	if len(cur) > 0 || len(lines) == 0 {
+		lines = append(lines, string(cur))
+	}
+	return lines
+}
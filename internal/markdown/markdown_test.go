@@ -0,0 +1,80 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNotes = `# FrSky OSD 2.1.0
+
+Release with **important** fixes,
+see the [manual](https://example.com/manual).
+
+## Changes
+- Faster font uploads
+- Fixed ` + "`crash`" + ` when
+  drawing
+  * Nested item
+1. Numbered
+
+Setext
+------
+
+` + "```" + `
+flash --force
+` + "```" + `
+
+***
+`
+
+func TestParse(t *testing.T) {
+	blocks := Parse(testNotes)
+	expected := []*Block{
+		{Kind: Heading, Level: 1, Text: "FrSky OSD 2.1.0"},
+		{Kind: Paragraph, Text: "Release with **important** fixes, see the [manual](https://example.com/manual)."},
+		{Kind: Heading, Level: 2, Text: "Changes"},
+		{Kind: ListItem, Text: "Faster font uploads"},
+		{Kind: ListItem, Text: "Fixed `crash` when drawing"},
+		{Kind: ListItem, Level: 1, Text: "Nested item"},
+		{Kind: ListItem, Text: "Numbered"},
+		{Kind: Heading, Level: 2, Text: "Setext"},
+		{Kind: Code, Text: "flash --force"},
+		{Kind: Rule},
+	}
+	assert.Equal(t, expected, blocks)
+}
+
+func TestPlain(t *testing.T) {
+	assert.Equal(t, "Release with important fixes, see the manual.",
+		Plain("Release with **important** fixes, see the [manual](https://example.com/manual)."))
+	assert.Equal(t, "an emphasized crash in file_name", Plain("an *emphasized* `crash` in file_name"))
+}
+
+func TestHTML(t *testing.T) {
+	s := HTML("# Title\n\n- a & b\n  - **c**\n- d\n\ntext\n")
+	assert.Equal(t, "<h1>Title</h1>\n"+
+		"<ul>\n<li>a &amp; b<ul>\n<li><strong>c</strong></li>\n</ul>\n</li>\n<li>d</li>\n</ul>\n"+
+		"<p>text</p>\n", s)
+}
+
+func TestHTMLLinks(t *testing.T) {
+	links := map[string]string{
+		"[manual](https://example.com/a?b=1&c=2)": `<a href="https://example.com/a?b=1&amp;c=2">manual</a>`,
+		"[docs](http://example.com)":              `<a href="http://example.com">docs</a>`,
+		"[notes](../notes.md)":                    `<a href="../notes.md">notes</a>`,
+		"[x](javascript:alert(1))":                "x)",
+		"[x](JavaScript:alert)":                   "x",
+		"[x](data:text/html,hi)":                  "x",
+		"[x](file:///etc/passwd)":                 "x",
+		`[x](" onclick="alert)`:                   `[x](&#34; onclick=&#34;alert)`,
+	}
+	for md, expected := range links {
+		assert.Equal(t, "<p>"+expected+"</p>\n", HTML(md), md)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, []string{"one two", "three", "verylongword"}, Wrap("one two three verylongword", 8))
+	assert.Equal(t, []string{""}, Wrap("", 8))
+}
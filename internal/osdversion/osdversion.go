@@ -1,12 +1,117 @@
 package osdversion
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// betaMinor is the minor version used on the wire by
+	// beta versions. x.99.y is displayed as (x+1).0.0-beta.(y+1)
+	betaMinor = 99
+	betaTag   = "-beta."
+)
+
+// Version represents an OSD firmware version, with its components
+// as they're sent on the wire. Versions are ordered by their
+// components, which places betas before their final release.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// New returns a Version from its wire components
+func New(major, minor, patch int) Version {
+	return Version{Major: major, Minor: minor, Patch: patch}
+}
+
+// Parse parses an user-visible version string like "2.0.1" or
+// "2.0.0-beta.1", optionally starting with a "v", into its wire
+// components.
+func Parse(s string) (Version, error) {
+	orig := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	beta := 0
+	if idx := strings.Index(s, betaTag); idx >= 0 {
+		var extra string
+		if n, err := fmt.Sscanf(s[idx+len(betaTag):], "%d%s", &beta, &extra); n != 1 || beta < 1 {
+			if err == nil {
+				err = fmt.Errorf("invalid beta number")
+			}
+			return Version{}, fmt.Errorf("invalid version %q: %v", orig, err)
+		}
+		s = s[:idx]
+	}
+	var v Version
+	var extra string
+	if n, err := fmt.Sscanf(s, "%d.%d.%d%s", &v.Major, &v.Minor, &v.Patch, &extra); n != 3 {
+		if err == nil {
+			err = fmt.Errorf("unexpected %q", extra)
+		}
+		return Version{}, fmt.Errorf("invalid version %q: %v", orig, err)
+	}
+	if v.Major < 0 || v.Minor < 0 || v.Patch < 0 {
+		return Version{}, fmt.Errorf("invalid version %q: negative component", orig)
+	}
+	if beta > 0 {
+		if v.Major < 1 || v.Minor != 0 || v.Patch != 0 {
+			return Version{}, fmt.Errorf("invalid version %q: betas must be x.0.0-beta.y", orig)
+		}
+		return New(v.Major-1, betaMinor, beta-1), nil
+	}
+	return v, nil
+}
+
+// MustParse works like Parse, but panics on errors
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// IsBeta returns true iff the version is a beta
+func (v Version) IsBeta() bool {
+	return v.Minor == betaMinor
+}
+
+// Compare returns -1 if v < other, 0 if v == other and 1
+// if v > other.
+func (v Version) Compare(other Version) int {
+	a := [...]int{v.Major, v.Minor, v.Patch}
+	b := [...]int{other.Major, other.Minor, other.Patch}
+	for ii := range a {
+		if a[ii] < b[ii] {
+			return -1
+		}
+		if a[ii] > b[ii] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Less returns true iff v < other
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// AtLeast returns true iff v >= other
+func (v Version) AtLeast(other Version) bool {
+	return v.Compare(other) >= 0
+}
+
+func (v Version) String() string {
+	return Format(v.Major, v.Minor, v.Patch)
+}
 
 // Format returns a user-visible version string from
 // the major, minor and patch components
 func Format(major, minor, patch int) string {
-	if minor == 99 {
-		return fmt.Sprintf("%d.%d.%d-beta.%d", major+1, 0, 0, patch+1)
+	if minor == betaMinor {
+		return fmt.Sprintf("%d.%d.%d%s%d", major+1, 0, 0, betaTag, patch+1)
 	}
 	return fmt.Sprintf("%d.%d.%d", major, minor, patch)
 }
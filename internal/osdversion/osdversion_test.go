@@ -0,0 +1,63 @@
+package osdversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		s string
+		v Version
+	}{
+		{"1.0.0", New(1, 0, 0)},
+		{"v2.0.1", New(2, 0, 1)},
+		{"2.0.0-beta.1", New(1, 99, 0)},
+		{"3.0.0-beta.12", New(2, 99, 11)},
+		{"1.99.0", New(1, 99, 0)},
+	}
+	for _, c := range cases {
+		v, err := Parse(c.s)
+		if assert.NoError(t, err, c.s) {
+			assert.Equal(t, c.v, v, c.s)
+		}
+	}
+	for _, s := range []string{"", "2", "2.0", "2.0.0.1", "2.0.0-beta", "2.0.0-beta.0", "2.0.1-beta.1", "0.0.0-beta.1", "2.0.0-rc.1", "a.b.c"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range []Version{New(1, 0, 0), New(1, 99, 0), New(2, 1, 3), New(2, 99, 4)} {
+		parsed, err := Parse(v.String())
+		if assert.NoError(t, err) {
+			assert.Equal(t, v, parsed)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"1.0.0", "1.0.1", "1.1.0", "2.0.0-beta.1", "2.0.0-beta.2", "2.0.0", "2.0.1", "3.0.0-beta.1", "3.0.0"}
+	for ii := range ordered {
+		for jj := range ordered {
+			a := MustParse(ordered[ii])
+			b := MustParse(ordered[jj])
+			switch {
+			case ii < jj:
+				assert.Equal(t, -1, a.Compare(b), "%s < %s", a, b)
+				assert.True(t, a.Less(b))
+				assert.False(t, a.AtLeast(b))
+			case ii == jj:
+				assert.Equal(t, 0, a.Compare(b))
+				assert.True(t, a.AtLeast(b))
+			default:
+				assert.Equal(t, 1, a.Compare(b), "%s > %s", a, b)
+				assert.True(t, a.AtLeast(b))
+			}
+		}
+	}
+	assert.True(t, MustParse("2.0.0-beta.1").IsBeta())
+	assert.False(t, MustParse("2.0.0").IsBeta())
+}
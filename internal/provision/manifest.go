@@ -0,0 +1,125 @@
+package provision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"osdapp/firmware"
+	"osdapp/frskyosd"
+)
+
+// Manifest describes the state OSDs are provisioned to. Every
+// field is optional, but at least one must be set.
+type Manifest struct {
+	// Firmware is the path to a firmware file or the version of
+	// an available firmware, "latest" for the newest one. OSDs
+	// already running that version aren't flashed.
+	Firmware string `json:"firmware,omitempty"`
+	// Beta allows "latest" to select beta firmwares
+	Beta bool `json:"beta,omitempty"`
+	// Force flashes firmwares that don't pass validation and
+	// uploads fonts with errors
+	Force bool `json:"force,omitempty"`
+	// Font is the path to the .mcm file to upload
+	Font string `json:"font,omitempty"`
+	// Settings are changed and saved to the OSD. Settings that
+	// aren't present keep their current values.
+	Settings *Settings `json:"settings,omitempty"`
+}
+
+// Settings contains the OSD settings set by a Manifest
+type Settings struct {
+	Brightness       *int `json:"brightness,omitempty"`
+	HorizontalOffset *int `json:"horizontal_offset,omitempty"`
+	VerticalOffset   *int `json:"vertical_offset,omitempty"`
+}
+
+// fields returns the settings with their names and the
+// corresponding fields in the SettingsMessage
+func (s *Settings) fields(m *frskyosd.SettingsMessage) []struct {
+	name  string
+	value *int
+	field *int8
+} {
+	return []struct {
+		name  string
+		value *int
+		field *int8
+	}{
+		{"brightness", s.Brightness, &m.Brightness},
+		{"horizontal_offset", s.HorizontalOffset, &m.HorizontalOffset},
+		{"vertical_offset", s.VerticalOffset, &m.VerticalOffset},
+	}
+}
+
+// apply sets the fields present in s in m
+func (s *Settings) apply(m *frskyosd.SettingsMessage) {
+	for _, f := range s.fields(m) {
+		if f.value != nil {
+			*f.field = int8(*f.value)
+		}
+	}
+}
+
+// check returns an error if any of the fields present in s
+// doesn't match m
+func (s *Settings) check(m *frskyosd.SettingsMessage) error {
+	for _, f := range s.fields(m) {
+		if f.value != nil && int(*f.field) != *f.value {
+			return fmt.Errorf("OSD set %s to %d instead of %d", f.name, *f.field, *f.value)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the manifest is empty or has
+// invalid settings
+func (m *Manifest) Validate() error {
+	if m.Firmware == "" && m.Font == "" && m.Settings == nil {
+		return errors.New("manifest has no firmware, font or settings")
+	}
+	if m.Settings != nil {
+		for _, f := range m.Settings.fields(&frskyosd.SettingsMessage{}) {
+			if f.value != nil && (*f.value < math.MinInt8 || *f.value > math.MaxInt8) {
+				return fmt.Errorf("invalid %s %d, must be between %d and %d", f.name, *f.value, math.MinInt8, math.MaxInt8)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadManifest reads the JSON manifest at the given path. Relative
+// paths in the manifest are relative to its directory.
+func LoadManifest(p string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	dir := filepath.Dir(p)
+	if m.Font != "" && !filepath.IsAbs(m.Font) {
+		m.Font = filepath.Join(dir, m.Font)
+	}
+	if m.Firmware != "" && isPath(m.Firmware) && !filepath.IsAbs(m.Firmware) {
+		m.Firmware = filepath.Join(dir, m.Firmware)
+	}
+	return &m, nil
+}
+
+// isPath returns true iff the firmware in a manifest is a path
+// rather than a version. Versions have neither separators nor
+// a firmware file extension.
+func isPath(s string) bool {
+	return strings.ContainsAny(s, `/\`) || firmware.IsFirmwareFilename(s)
+}
@@ -0,0 +1,285 @@
+// Package provision applies a Manifest with a firmware, a font and
+// settings to several OSDs in parallel, producing a report with
+// the result for each one.
+package provision
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fiam/max7456tool/mcm"
+
+	"osdapp/firmware"
+	"osdapp/fonts"
+	"osdapp/frskyosd"
+	"osdapp/internal/device"
+	"osdapp/internal/osdversion"
+)
+
+// Plan is a Manifest with its firmware and font loaded and
+// validated, ready to be applied to any number of OSDs.
+type Plan struct {
+	Manifest *Manifest
+	// FirmwareName is the name of the firmware file, empty
+	// if the manifest has no firmware
+	FirmwareName string
+	// FirmwareVersion is the version of the firmware, nil if
+	// the manifest has no firmware or it's unknown
+	FirmwareVersion *osdversion.Version
+
+	firmware []byte
+	font     []byte
+	fontFP   *fonts.Fingerprint
+}
+
+// Prepare loads the firmware and the font in the manifest. Firmware
+// versions are looked up in the given sources and cache. See
+// firmware.Resolve.
+func Prepare(ctx context.Context, m *Manifest, sources []firmware.Source, cache *firmware.Cache) (*Plan, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Plan{Manifest: m}
+	if m.Firmware != "" {
+		fw, f, err := firmware.Resolve(ctx, m.Firmware, sources, cache, m.Beta)
+		if err != nil {
+			return nil, fmt.Errorf("firmware %s: %v", m.Firmware, err)
+		}
+		img, err := firmware.ParseImage(fw.Data)
+		if err == nil && f != nil {
+			err = img.CheckVersion(f)
+		}
+		if err != nil && !m.Force {
+			return nil, fmt.Errorf("firmware %s: %v", m.Firmware, err)
+		}
+		if f != nil {
+			if v, err := f.Version(); err == nil {
+				p.FirmwareVersion = &v
+			}
+		} else if img != nil && img.HasVersion() {
+			p.FirmwareVersion = img.Version
+		}
+		p.FirmwareName = fw.Name
+		p.firmware = fw.Data
+	}
+	if m.Font != "" {
+		data, err := ioutil.ReadFile(m.Font)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := mcm.NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("font %s: %v", m.Font, err)
+		}
+		for _, v := range fonts.Lint(dec, nil) {
+			if v.Severity == fonts.LintError && !m.Force {
+				return nil, fmt.Errorf("font %s: %v", m.Font, v)
+			}
+		}
+		p.font = data
+		p.fontFP = fonts.FingerprintFont(dec)
+	}
+	return p, nil
+}
+
+// Options contains the options for Plan.Run
+type Options struct {
+	// Ports to provision. If empty, every port reported by
+	// frskyosd.AvailablePorts is used.
+	Ports []string
+	// Parallel limits the number of OSDs provisioned at the
+	// same time, zero means no limit.
+	Parallel int
+	// Progress, if non-nil, is called with status updates for
+	// each port. Note that it's called from several goroutines.
+	Progress func(port string, status string)
+}
+
+// Result is the outcome of provisioning an OSD
+type Result struct {
+	Port           string    `json:"port"`
+	Passed         bool      `json:"passed"`
+	Error          string    `json:"error,omitempty"`
+	FirmwareBefore string    `json:"firmware_before,omitempty"`
+	FirmwareAfter  string    `json:"firmware_after,omitempty"`
+	Flashed        bool      `json:"flashed"`
+	FontUploaded   bool      `json:"font_uploaded"`
+	SettingsSaved  bool      `json:"settings_saved"`
+	Started        time.Time `json:"started"`
+	Seconds        float64   `json:"seconds"`
+}
+
+// Run applies the plan to the OSDs connected to the ports in opts,
+// in parallel. It returns one Result per port, in the same order
+// as the ports, and only fails if the ports can't be listed.
+func (p *Plan) Run(ctx context.Context, opts *Options) ([]*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	ports := opts.Ports
+	if len(ports) == 0 {
+		var err error
+		if ports, err = device.AvailablePorts(); err != nil {
+			return nil, err
+		}
+		sort.Strings(ports)
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports found")
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 || parallel > len(ports) {
+		parallel = len(ports)
+	}
+	results := make([]*Result, len(ports))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for ii, port := range ports {
+		wg.Add(1)
+		go func(ii int, port string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			progress := func(status string) {
+				if opts.Progress != nil {
+					opts.Progress(port, status)
+				}
+			}
+			results[ii] = p.provision(ctx, port, progress)
+		}(ii, port)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (p *Plan) provision(ctx context.Context, port string, progress func(string)) *Result {
+	res := &Result{Port: port, Started: time.Now()}
+	err := p.apply(ctx, res, progress)
+	res.Seconds = time.Since(res.Started).Seconds()
+	if err != nil {
+		res.Error = err.Error()
+		progress("Failed: " + res.Error)
+	} else {
+		res.Passed = true
+		progress("Passed")
+	}
+	return res
+}
+
+func (p *Plan) apply(ctx context.Context, res *Result, progress func(string)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	progress("Connecting...")
+	dev, err := device.Open(res.Port)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	info, err := dev.Info()
+	if err != nil {
+		return err
+	}
+	if !info.IsBootloader {
+		res.FirmwareBefore = info.FirmwareVersion().String()
+	}
+	if p.firmware != nil && p.needsFlashing(info) {
+		err := dev.FlashFirmwareWithOptions(ctx, bytes.NewReader(p.firmware), &frskyosd.FlashOptions{
+			Validate: firmware.Validate,
+			Force:    p.Manifest.Force,
+			Progress: func(fp *frskyosd.FlashProgress) {
+				progress(fp.String())
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("flashing: %v", err)
+		}
+		res.Flashed = true
+		if info, err = dev.Info(); err != nil {
+			return err
+		}
+	}
+	if info.IsBootloader {
+		return errors.New("OSD is in bootloader mode")
+	}
+	installed := info.FirmwareVersion()
+	res.FirmwareAfter = installed.String()
+	if p.firmware != nil && p.FirmwareVersion != nil && installed.Compare(*p.FirmwareVersion) != 0 {
+		return fmt.Errorf("OSD is running firmware %s instead of %s", installed, p.FirmwareVersion)
+	}
+	if p.font != nil {
+		if err := p.uploadFont(dev, progress); err != nil {
+			return err
+		}
+		res.FontUploaded = true
+	}
+	if s := p.Manifest.Settings; s != nil {
+		progress("Saving settings...")
+		if err := applySettings(dev, s); err != nil {
+			return err
+		}
+		res.SettingsSaved = true
+	}
+	return nil
+}
+
+// needsFlashing returns true if the firmware must be flashed to
+// the OSD with the given info
+func (p *Plan) needsFlashing(info *frskyosd.InfoMessage) bool {
+	return info.IsBootloader || p.FirmwareVersion == nil ||
+		info.FirmwareVersion().Compare(*p.FirmwareVersion) != 0
+}
+
+// uploadFont uploads the font and reads it back to verify it
+func (p *Plan) uploadFont(dev device.Device, progress func(string)) error {
+	err := dev.UploadFont(bytes.NewReader(p.font), func(done, total int) {
+		progress(fmt.Sprintf("Writing font (%03d/%03d)...", done, total))
+	})
+	if err != nil {
+		return fmt.Errorf("uploading font: %v", err)
+	}
+	chars := make([][]byte, p.fontFP.NChars())
+	for ii := range chars {
+		msg, err := dev.ReadFontChar(uint(ii))
+		if err != nil {
+			return fmt.Errorf("verifying font: %v", err)
+		}
+		progress(fmt.Sprintf("Verifying font (%03d/%03d)...", ii+1, len(chars)))
+		chars[ii] = msg.Data[:]
+	}
+	fp, err := fonts.NewFingerprint(chars)
+	if err != nil {
+		return err
+	}
+	if diff := fp.Diff(p.fontFP); len(diff) > 0 {
+		return fmt.Errorf("font verification failed in characters %s", fonts.FormatCharRanges(diff))
+	}
+	return nil
+}
+
+// applySettings changes and saves the settings, checking that
+// the OSD accepted them
+func applySettings(dev device.Device, s *Settings) error {
+	current, err := dev.ReadSettings()
+	if err != nil {
+		return fmt.Errorf("reading settings: %v", err)
+	}
+	s.apply(current)
+	updated, err := dev.SetSettings(current)
+	if err != nil {
+		return fmt.Errorf("changing settings: %v", err)
+	}
+	if err := s.check(updated); err != nil {
+		return err
+	}
+	if err := dev.SaveSettings(); err != nil {
+		return fmt.Errorf("saving settings: %v", err)
+	}
+	return nil
+}
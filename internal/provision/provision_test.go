@@ -0,0 +1,241 @@
+package provision
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fiam/max7456tool/mcm"
+	"github.com/stretchr/testify/assert"
+
+	"osdapp/internal/device/devicetest"
+	"osdapp/internal/osdversion"
+)
+
+// newDevice returns a fake OSD running the given version,
+// which runs 2.1.0 after flashing any firmware
+func newDevice(version string) *devicetest.Fake {
+	d := devicetest.NewFake(version)
+	d.FlashedVersion = osdversion.New(2, 1, 0)
+	return d
+}
+
+func testFont(t *testing.T, b byte) []byte {
+	chars := make(map[int]*mcm.Char, mcm.ExtendedCharNum)
+	for ii := 0; ii < mcm.ExtendedCharNum; ii++ {
+		chr, err := mcm.NewCharFromData(bytes.Repeat([]byte{b}, mcm.CharBytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chars[ii] = chr
+	}
+	var buf bytes.Buffer
+	enc := &mcm.Encoder{Chars: chars, Fill: true}
+	if err := enc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestLoadManifest(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	p := filepath.Join(dir, "manifest.json")
+	data := `{"firmware": "fw/osd.bin", "font": "font.mcm", "settings": {"brightness": 20}}`
+	if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(p)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(dir, "fw", "osd.bin"), m.Firmware)
+		assert.Equal(t, filepath.Join(dir, "font.mcm"), m.Font)
+		assert.Equal(t, 20, *m.Settings.Brightness)
+	}
+
+	if err := ioutil.WriteFile(p, []byte(`{"firmware": "2.1.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = LoadManifest(p)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2.1.0", m.Firmware)
+	}
+
+	invalid := map[string]string{
+		`{}`: "manifest has no firmware, font or settings",
+		`{"settings": {"vertical_offset": -200}}`: "invalid vertical_offset -200",
+		`{"font": 1}`: "cannot unmarshal",
+	}
+	for data, expected := range invalid {
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadManifest(p)
+		if assert.Error(t, err, data) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	fontPath := filepath.Join(dir, "font.mcm")
+	if err := ioutil.WriteFile(fontPath, testFont(t, 0xAA), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fwPath := filepath.Join(dir, "osd.bin")
+	if err := ioutil.WriteFile(fwPath, []byte("not a firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{
+		Firmware: fwPath,
+		Font:     fontPath,
+		Settings: &Settings{VerticalOffset: intPtr(-3)},
+	}
+	_, err := Prepare(context.Background(), m, nil, nil)
+	assert.Error(t, err, "invalid firmware must require force")
+
+	m.Force = true
+	plan, err := Prepare(context.Background(), m, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	good := newDevice("2.0.0")
+	bootloader := newDevice("2.0.0")
+	bootloader.Bootloader = true
+	corrupt := newDevice("2.0.0")
+	corrupt.Corrupt = 300
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"c": corrupt, "a": good, "b": bootloader})()
+
+	var mu sync.Mutex
+	var statuses []string
+	results, err := plan.Run(context.Background(), &Options{
+		Parallel: 2,
+		Progress: func(port string, status string) {
+			mu.Lock()
+			statuses = append(statuses, port+": "+status)
+			mu.Unlock()
+		},
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, results, 3) {
+		return
+	}
+	assert.Equal(t, "a", results[0].Port)
+	assert.True(t, results[0].Passed)
+	assert.Equal(t, "2.0.0", results[0].FirmwareBefore)
+	assert.Equal(t, "2.1.0", results[0].FirmwareAfter)
+	assert.True(t, results[0].Flashed)
+	assert.True(t, results[0].FontUploaded)
+	assert.True(t, results[0].SettingsSaved)
+	assert.Equal(t, []byte("not a firmware"), good.Flashed)
+	assert.Equal(t, int8(-3), good.Settings.VerticalOffset)
+	assert.True(t, good.Saved)
+	assert.True(t, good.Closed)
+
+	assert.Equal(t, "b", results[1].Port)
+	assert.True(t, results[1].Passed)
+	assert.Empty(t, results[1].FirmwareBefore)
+	assert.True(t, results[1].Flashed)
+
+	assert.Equal(t, "c", results[2].Port)
+	assert.False(t, results[2].Passed)
+	assert.Equal(t, "font verification failed in characters 300", results[2].Error)
+	assert.False(t, results[2].SettingsSaved)
+	assert.False(t, corrupt.Saved)
+
+	assert.Equal(t, Summary{Passed: 2, Failed: 1}, Summarize(results))
+	sort.Strings(statuses)
+	assert.Contains(t, statuses, "a: Passed")
+	assert.Contains(t, statuses, "c: Failed: font verification failed in characters 300")
+}
+
+func TestRunSkipsFlashing(t *testing.T) {
+	v := osdversion.New(2, 0, 0)
+	plan := &Plan{
+		Manifest:        &Manifest{Firmware: "2.0.0", Force: true, Settings: &Settings{Brightness: intPtr(60)}},
+		FirmwareVersion: &v,
+		firmware:        []byte("firmware"),
+	}
+	current := newDevice("2.0.0")
+	old := newDevice("1.0.0")
+	defer devicetest.WithDevices(map[string]*devicetest.Fake{"current": current, "old": old})()
+
+	results, err := plan.Run(context.Background(), &Options{Ports: []string{"current", "old", "missing"}})
+	if !assert.NoError(t, err) || !assert.Len(t, results, 3) {
+		return
+	}
+	// The fake OSD limits the brightness to 50
+	assert.False(t, results[0].Passed)
+	assert.Equal(t, "OSD set brightness to 50 instead of 60", results[0].Error)
+	assert.False(t, results[0].Flashed)
+	assert.Nil(t, current.Flashed)
+	assert.False(t, current.Saved)
+	// The fake always flashes 2.1.0
+	assert.False(t, results[1].Passed)
+	assert.True(t, results[1].Flashed)
+	assert.Equal(t, "OSD is running firmware 2.1.0 instead of 2.0.0", results[1].Error)
+	assert.Equal(t, "no such port", results[2].Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = plan.Run(ctx, &Options{Ports: []string{"current"}})
+	if assert.NoError(t, err) && assert.Len(t, results, 1) {
+		assert.Equal(t, context.Canceled.Error(), results[0].Error)
+	}
+
+	defer devicetest.WithDevices(nil)()
+	_, err = plan.Run(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestWriteReport(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	results := []*Result{
+		{Port: "a", Passed: true, FirmwareAfter: "2.0.0", Flashed: true, Seconds: 12.34},
+		{Port: "b", Error: `bad "font"`},
+	}
+	csvPath := filepath.Join(dir, "report.csv")
+	if assert.NoError(t, WriteReport(csvPath, results)) {
+		data, err := ioutil.ReadFile(csvPath)
+		if assert.NoError(t, err) {
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if assert.Len(t, lines, 3) {
+				assert.Equal(t, strings.Join(csvHeader, ","), lines[0])
+				assert.True(t, strings.HasPrefix(lines[1], "a,true,,,2.0.0,true,false,false,"))
+				assert.True(t, strings.HasSuffix(lines[1], ",12.3"))
+				assert.True(t, strings.HasPrefix(lines[2], `b,false,"bad ""font""",`))
+			}
+		}
+	}
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if assert.NoError(t, WriteReport(jsonPath, results)) {
+		data, err := ioutil.ReadFile(jsonPath)
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(data), `"passed": 1`)
+			assert.Contains(t, string(data), `"failed": 1`)
+			assert.Contains(t, string(data), `"error": "bad \"font\""`)
+		}
+	}
+}
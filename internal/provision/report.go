@@ -0,0 +1,92 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"osdapp/internal/atomicfile"
+)
+
+// Summary counts the passed and failed results
+type Summary struct {
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+// Summarize returns the Summary for the given results
+func Summarize(results []*Result) Summary {
+	var s Summary
+	for _, r := range results {
+		if r.Passed {
+			s.Passed++
+		} else {
+			s.Failed++
+		}
+	}
+	return s
+}
+
+var csvHeader = []string{
+	"port", "passed", "error", "firmware_before", "firmware_after",
+	"flashed", "font_uploaded", "settings_saved", "started", "seconds",
+}
+
+// WriteCSV writes the results as CSV, with a header row
+func WriteCSV(w io.Writer, results []*Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		err := cw.Write([]string{
+			r.Port,
+			strconv.FormatBool(r.Passed),
+			r.Error,
+			r.FirmwareBefore,
+			r.FirmwareAfter,
+			strconv.FormatBool(r.Flashed),
+			strconv.FormatBool(r.FontUploaded),
+			strconv.FormatBool(r.SettingsSaved),
+			r.Started.Format(time.RFC3339),
+			strconv.FormatFloat(r.Seconds, 'f', 1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the results and their summary as JSON
+func WriteJSON(w io.Writer, results []*Result) error {
+	if results == nil {
+		results = []*Result{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Summary
+		Results []*Result `json:"results"`
+	}{Summarize(results), results})
+}
+
+// WriteReport writes the results to the file at p, as CSV if it
+// has a .csv extension and as JSON otherwise.
+func WriteReport(p string, results []*Result) error {
+	write := WriteJSON
+	if strings.ToLower(filepath.Ext(p)) == ".csv" {
+		write = WriteCSV
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, results); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(p, buf.Bytes(), 0644)
+}
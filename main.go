@@ -2,12 +2,13 @@ package main // import "osdapp"
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/user"
 	"path"
@@ -15,6 +16,8 @@ import (
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne"
@@ -31,6 +34,7 @@ import (
 	"osdapp/frskyosd"
 	"osdapp/internal/autoupdater"
 	"osdapp/internal/dialog"
+	"osdapp/internal/httpclient"
 	"osdapp/internal/osdversion"
 )
 
@@ -39,12 +43,24 @@ const (
 	fontsExt   = ".mcm"
 	appVersion = "2.0.3"
 
-	updatesSource = "https://github.com/FrSkyRC/FrSkyOSDApp"
+	firmwareSourcesFile = "firmware-sources"
+	firmwareCacheDir    = "firmware"
+	pendingFirmwareFile = "pending.bin"
 
-	settingsNotSupportedMessage = "Settings require firmware v2.\nUse the \"Flash Firmware\" button to upgrade."
-	bootloaderModeMessage       = `That probably means there's no valid firmware loaded.
-Use the "Flash Firmware" button to flash a firmware`
-	fontsUpdateInterval = 1 * time.Hour
+	updatesSource        = "https://github.com/FrSkyRC/FrSkyOSDApp"
+	updatesSourceFile    = "updates-source"
+	autoupdaterStoreFile = "autoupdater.json"
+	httpCacheDir         = "http-cache"
+
+	resumeFlashMessage = `A previous firmware update didn't finish.
+Resume flashing the same firmware?`
+	resumeInvalidFlashMessage = `A previous firmware update didn't finish, but
+the firmware doesn't look valid for the OSD:
+%v
+Flashing it might leave the OSD stuck in bootloader mode.
+Resume flashing it anyway?`
+	fontsUpdateInterval  = 1 * time.Hour
+	updatesCheckInterval = 12 * time.Hour
 )
 
 // App is an opaque type that contains the whole application state
@@ -57,44 +73,78 @@ type App struct {
 	connectButton        *widget.Button
 	versionLabel         *widget.Label
 	uploadFontButton     *widget.Button
+	composeFontButton    *widget.Button
+	uploadLogoButton     *widget.Button
+	uploadLogoDialog     dialog.Dialog
+	installedFontLabel   *widget.Label
 	fontItems            []*FontIcon
+	fontBrowser          *fontBrowser
 	uploadFontDialog     dialog.Dialog
 	settingsButton       *widget.Button
 	flashFirmwareButton  *widget.Button
 	selectFirmwareDialog *firmwaresDialog
+	firmwareCache        *firmware.Cache
 	connectedPort        string
 	osd                  *frskyosd.OSD
 	info                 *frskyosd.InfoMessage
+	caps                 *frskyosd.Capabilities
+	// infoChanges is incremented every time the OSD info
+	// changes. Use atomic operations to access it.
+	infoChanges         uint32
+	updateBanner        *updateBanner
+	updateChannelSelect *widget.Select
+	betaFirmwareCheck   *widget.Check
+	prefs               *preferences
+	autoupdater         *autoupdater.AutoUpdater
+	stopAutoupdater     context.CancelFunc
+	provisioning        *provisioningTab
+	// betaFirmware is 1 if the user opted in to be notified
+	// about beta firmwares. Use atomic operations to access it.
+	betaFirmware uint32
 }
 
-func newApp() *App {
+// newApp returns a new App. If betaFirmware is true, beta
+// firmwares are enabled regardless of the preferences.
+func newApp(betaFirmware bool) *App {
 	a := &App{}
 	a.app = app.New()
+	a.firmwareCache = firmware.NewCache(a.storagePath(firmwareCacheDir))
+	prefs, err := a.loadPreferences()
+	if err != nil {
+		log.Warnf("could not load preferences: %v", err)
+		prefs = &preferences{}
+	}
+	a.prefs = prefs
 	a.updatePorts()
 	a.connectButton = widget.NewButton("Connect", a.connectOrDisconnect)
 	a.connectButton.Disable()
 	a.portsSelect = widget.NewSelect(a.ports, a.portSelectionChanged)
 	a.uploadFontButton = widget.NewButton("Upload Font", a.uploadFont)
+	a.composeFontButton = widget.NewButton("Compose Font", a.composeFont)
+	a.uploadLogoButton = widget.NewButton("Upload Logo", a.uploadLogo)
 	a.settingsButton = widget.NewButton("Settings", a.showSettings)
 	versionStyle := fyne.TextStyle{
 		Monospace: true,
 	}
 	a.versionLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, versionStyle)
-	var row []fyne.CanvasObject
-	var fontRows []fyne.CanvasObject
-	for ii := 0; ii < fontCharCount; ii++ {
-		if ii%fontRowSize == 0 {
-			if len(row) > 0 {
-				hbox := widget.NewHBox(row...)
-				fontRows = append(fontRows, hbox)
-			}
-			row = nil
-		}
-		fi := NewFontIcon()
-		row = append(row, &fi.Image)
-		a.fontItems = append(a.fontItems, fi)
-	}
+	a.installedFontLabel = widget.NewLabel("")
+	a.fontBrowser = newFontBrowser(fontCharCount, fontRowSize)
+	a.fontItems = a.fontBrowser.Icons()
 	a.flashFirmwareButton = widget.NewButton("Flash Firmware", a.selectFirmware)
+	a.updateBanner = newUpdateBanner()
+	a.updateBanner.OnFlash = a.confirmFirmwareEntry
+	a.updateBanner.OnReleaseNotes = a.showFirmwareReleaseNotes
+	a.updateChannelSelect = widget.NewSelect(updateChannelNames, nil)
+	if a.prefs.AcceptsPrereleases() {
+		a.updateChannelSelect.SetSelected(updateChannelNames[1])
+	} else {
+		a.updateChannelSelect.SetSelected(updateChannelNames[0])
+	}
+	a.updateChannelSelect.OnChanged = a.updateChannelChanged
+	a.betaFirmwareCheck = widget.NewCheck("Beta Firmwares", nil)
+	a.betaFirmwareCheck.SetChecked(a.prefs.BetaFirmware || betaFirmware)
+	a.setBetaFirmware(a.betaFirmwareCheck.Checked)
+	a.betaFirmwareCheck.OnChanged = a.betaFirmwareChanged
 	windowTitle := "FrSky OSD"
 	if runtime.GOOS != "darwin" {
 		// Neither Windows nor Linux have an obvious way
@@ -104,21 +154,33 @@ func newApp() *App {
 	}
 	a.window = a.app.NewWindow(windowTitle)
 	a.window.SetIcon(fyne.NewStaticResource("Icon", iconBytes))
-	a.window.SetContent(widget.NewVBox(
+	a.provisioning = a.newProvisioningTab()
+	osdTab := widget.NewVBox(
 		widget.NewHBox(
 			widget.NewLabel("Port:"),
 			a.portsSelect,
 			layout.NewSpacer(),
 			a.connectButton,
 		),
+		a.updateBanner.CanvasObject(),
 		widget.NewHBox(
 			widget.NewLabel("Font:"),
+			a.installedFontLabel,
 			layout.NewSpacer(),
+			a.composeFontButton,
+			a.uploadLogoButton,
 			a.uploadFontButton,
 		),
-		widget.NewVBox(fontRows...),
+		a.fontBrowser.Grid(),
+		a.fontBrowser.Controls(),
 		layout.NewSpacer(),
-		widget.NewHBox(a.settingsButton, layout.NewSpacer()),
+		widget.NewHBox(
+			a.settingsButton,
+			layout.NewSpacer(),
+			a.betaFirmwareCheck,
+			widget.NewLabel("App Updates:"),
+			a.updateChannelSelect,
+		),
 		layout.NewSpacer(),
 		widget.NewHBox(
 			widget.NewLabelWithStyle("OSD Version:", fyne.TextAlignLeading, versionStyle),
@@ -126,6 +188,10 @@ func newApp() *App {
 			layout.NewSpacer(),
 			a.flashFirmwareButton,
 		),
+	)
+	a.window.SetContent(widget.NewTabContainer(
+		widget.NewTabItem("OSD", osdTab),
+		widget.NewTabItem("Provisioning", a.provisioning.CanvasObject()),
 	))
 	return a
 }
@@ -133,28 +199,93 @@ func newApp() *App {
 func (a *App) setInfo(info *frskyosd.InfoMessage) {
 	var text string
 	if info != nil {
-		if info.IsBootloader {
-			a.uploadFontButton.Disable()
+		caps := frskyosd.NewCapabilities(info)
+		if caps.Bootloader {
 			text = "Bootloader"
 		} else {
-			text = osdversion.Format(int(info.Version.Major), int(info.Version.Minor), int(info.Version.Patch))
-			a.uploadFontButton.Enable()
-			a.settingsButton.Enable()
+			text = caps.Version.String()
 		}
+		setEnabled(a.uploadFontButton, caps.Fonts)
+		setEnabled(a.uploadLogoButton, caps.Fonts)
+		setEnabled(a.settingsButton, caps.Settings)
 		a.flashFirmwareButton.Enable()
+		a.caps = caps
 	} else {
 		text = "Disconnected"
 		a.uploadFontButton.Disable()
+		a.uploadLogoButton.Disable()
 		a.flashFirmwareButton.Disable()
 		a.settingsButton.Disable()
+		a.caps = nil
 	}
 	a.versionLabel.SetText(text)
 	a.info = info
+	atomic.AddUint32(&a.infoChanges, 1)
+}
+
+// setEnabled enables or disables the button
+func setEnabled(b *widget.Button, enabled bool) {
+	if enabled {
+		b.Enable()
+	} else {
+		b.Disable()
+	}
+}
+
+// adviseFirmwareUpdate checks the available firmwares and shows
+// the update banner if there's a newer one than the installed.
+// Betas are only considered if the user opted in.
+func (a *App) adviseFirmwareUpdate(caps *frskyosd.Capabilities) {
+	if caps == nil || caps.Bootloader {
+		return
+	}
+	changes := atomic.LoadUint32(&a.infoChanges)
+	firmwares, err := a.loadFirmwares()
+	if err != nil {
+		log.Warnf("could not check for firmware updates: %v", err)
+		return
+	}
+	f := firmware.UpdateFor(caps.Version, firmwares, a.acceptsBetaFirmware())
+	if f == nil {
+		return
+	}
+	// Make sure the OSD didn't change while we were checking
+	if atomic.LoadUint32(&a.infoChanges) == changes {
+		a.updateBanner.Show(f)
+	}
+}
+
+// showBootloaderMode is called after connecting to an OSD in
+// bootloader mode. If a previous flash was interrupted, it offers
+// to resume it.
+func (a *App) showBootloaderMode() {
+	data, err := ioutil.ReadFile(a.pendingFirmwarePath())
+	if err != nil || len(data) == 0 {
+		a.showRecovery()
+		return
+	}
+	// The pending firmware might have been flashed anyway after
+	// failing validation, so it's checked again
+	msg := resumeFlashMessage
+	force := false
+	if err := firmware.Validate(data); err != nil {
+		msg = fmt.Sprintf(resumeInvalidFlashMessage, err)
+		force = true
+	}
+	dialog.ShowConfirm("OSD is in bootloader mode", msg, func(ok bool) {
+		if ok {
+			a.flashFirmwareData(data, force)
+		} else {
+			os.Remove(a.pendingFirmwarePath())
+			a.showRecovery()
+		}
+	}, a.window)
 }
 
 func (a *App) connectOrDisconnect() {
 	if a.connected {
 		a.connectButton.SetText("Connect")
+		a.updateBanner.Hide()
 		a.connected = false
 		a.clearFontItems()
 		a.osd.Close()
@@ -195,8 +326,9 @@ func (a *App) connectOrDisconnect() {
 			a.connected = true
 			prog.Hide()
 			if info.IsBootloader {
-				dlg := dialog.ShowInformation("OSD is in bootloader mode", bootloaderModeMessage, a.window)
-				dlg.Show()
+				a.showBootloaderMode()
+			} else {
+				go a.adviseFirmwareUpdate(a.caps)
 			}
 		}()
 
@@ -244,23 +376,31 @@ func (a *App) availablePorts() []string {
 	return ports
 }
 
-func (a *App) isConnectedToV2() bool {
-	if a.info != nil {
-		if a.info.Version.Major >= 2 {
-			return true
-		}
-		return a.info.Version.Major == 1 && a.info.Version.Minor >= 99
+// installedFirmwareVersion returns the version of the firmware
+// running in the connected OSD or nil if it's unknown.
+func (a *App) installedFirmwareVersion() *osdversion.Version {
+	if a.caps == nil || a.caps.Bootloader {
+		return nil
 	}
-	return false
+	v := a.caps.Version
+	return &v
 }
 
 func (a *App) clearFontItems() {
 	for _, v := range a.fontItems {
 		v.SetFont(nil)
 	}
+	a.installedFontLabel.SetText("")
+	a.fontBrowser.Refresh()
 }
 
 func (a *App) storagePath(rel string) string {
+	return storagePath(rel)
+}
+
+// storagePath returns the path for rel inside the app storage
+// directory, ~/.frskyosd
+func storagePath(rel string) string {
 	usr, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -342,6 +482,7 @@ func (a *App) updateFontItems(progress func(int)) error {
 	if os.Getenv("FRSKY_OSD_SKIP_FONT_ITEMS") == "1" {
 		return nil
 	}
+	chars := make([][]byte, len(a.fontItems))
 	for ii, v := range a.fontItems {
 		msg, err := a.osd.ReadFontChar(uint(ii))
 		if err != nil {
@@ -352,17 +493,63 @@ func (a *App) updateFontItems(progress func(int)) error {
 			progress(ii)
 		}
 		v.SetFont(msg)
+		chars[ii] = msg.Data[:]
 	}
+	a.fontBrowser.Refresh()
+	a.identifyInstalledFont(chars)
 	return nil
 }
 
+// identifyInstalledFont matches the characters read from the
+// OSD against the cached fonts and displays the result.
+func (a *App) identifyInstalledFont(chars [][]byte) {
+	fp, err := fonts.NewFingerprint(chars)
+	if err != nil {
+		log.Errorf("error fingerprinting installed font: %v", err)
+		return
+	}
+	candidates := make(map[string]*fonts.Fingerprint)
+	origins := make(map[string]string)
+	for _, cf := range a.cachedFonts() {
+		dec, err := fonts.DecodeFile(cf.Path)
+		if err != nil {
+			log.Warnf("error decoding font %s: %v", cf.Path, err)
+			continue
+		}
+		candidates[cf.String()] = fonts.FingerprintFont(dec)
+		origins[cf.String()] = cf.Origin
+	}
+	var text string
+	if m := fonts.Match(fp, candidates); m != nil {
+		text = m.Name
+		a.fontBrowser.SetSymbolMap(origins[m.Name])
+		if !m.IsExact() {
+			const maxDisplayedRanges = 3
+			diff := m.Differences
+			suffix := ""
+			if len(diff) > maxDisplayedRanges {
+				diff = diff[:maxDisplayedRanges]
+				suffix = ", ..."
+			}
+			text += fmt.Sprintf(" (modified %s%s)", fonts.FormatCharRanges(diff), suffix)
+			log.Infof("installed font differs from %s in %s", m.Name, fonts.FormatCharRanges(m.Differences))
+		}
+		log.Debugf("installed font %s matches %s with %d chars", fp.Sum(), m.Name, m.Matching)
+	} else {
+		text = "Unknown"
+		log.Debugf("installed font %s doesn't match any cached font", fp.Sum())
+	}
+	a.installedFontLabel.SetText(text)
+}
+
 func (a *App) portSelectionChanged(selected string) {
 	if a.connected {
 		if a.portsSelect.Selected != a.connectedPort {
 			a.portsSelect.SetSelected(a.connectedPort)
 		}
 	} else {
-		if selected != "" {
+		// Ports are in use while provisioning
+		if selected != "" && !a.provisioning.isRunning() {
 			a.connectButton.Enable()
 		} else {
 			a.connectButton.Disable()
@@ -370,14 +557,27 @@ func (a *App) portSelectionChanged(selected string) {
 	}
 }
 
-func (a *App) uploadFont() {
-	var tabItems []*widget.TabItem
+// cachedFont represents a font stored in the local fonts
+// directory, grouped by its origin.
+type cachedFont struct {
+	Origin string
+	Name   string
+	Path   string
+}
+
+func (f *cachedFont) String() string {
+	return f.Origin + " / " + f.Name
+}
+
+// cachedFonts returns all the fonts stored in the local
+// fonts directory.
+func (a *App) cachedFonts() []*cachedFont {
+	var cached []*cachedFont
 	fontsStorageDir := a.storagePath(fontsDir)
 	entries, _ := ioutil.ReadDir(fontsStorageDir)
 	for _, entry := range entries {
-		name := entry.Name()
-		var fontItems []fyne.CanvasObject
-		p := filepath.Join(fontsStorageDir, name)
+		origin := entry.Name()
+		p := filepath.Join(fontsStorageDir, origin)
 		fontEntries, _ := ioutil.ReadDir(p)
 		for _, fe := range fontEntries {
 			if fe.IsDir() {
@@ -388,26 +588,46 @@ func (a *App) uploadFont() {
 			if ext != fontsExt {
 				continue
 			}
-			fontItems = append(fontItems, widget.NewButton(name[:len(name)-len(ext)], func() {
-				a.uploadFontFilename(filepath.Join(p, name))
-			}))
-		}
-		if len(fontItems) > 0 {
-			sort.Slice(fontItems, func(i, j int) bool {
-				wi := fontItems[i].(*widget.Button)
-				wj := fontItems[j].(*widget.Button)
-				if wi.Text == "Default" {
-					return true
-				}
-				if wj.Text == "Default" {
-					return false
-				}
-				return wi.Text < wj.Text
+			cached = append(cached, &cachedFont{
+				Origin: origin,
+				Name:   name[:len(name)-len(ext)],
+				Path:   filepath.Join(p, name),
 			})
-			tabContent := widget.NewVBox(fontItems...)
-			tabItems = append(tabItems, widget.NewTabItem(name, tabContent))
 		}
 	}
+	return cached
+}
+
+func (a *App) uploadFont() {
+	var tabItems []*widget.TabItem
+	fontItemsByOrigin := make(map[string][]fyne.CanvasObject)
+	var origins []string
+	for _, cf := range a.cachedFonts() {
+		cf := cf
+		if _, found := fontItemsByOrigin[cf.Origin]; !found {
+			origins = append(origins, cf.Origin)
+		}
+		fontItemsByOrigin[cf.Origin] = append(fontItemsByOrigin[cf.Origin], widget.NewButton(cf.Name, func() {
+			symbols, _ := fonts.SymbolMapNamed(cf.Origin)
+			a.uploadFontFilename(cf.Path, symbols)
+		}))
+	}
+	for _, origin := range origins {
+		fontItems := fontItemsByOrigin[origin]
+		sort.Slice(fontItems, func(i, j int) bool {
+			wi := fontItems[i].(*widget.Button)
+			wj := fontItems[j].(*widget.Button)
+			if wi.Text == "Default" {
+				return true
+			}
+			if wj.Text == "Default" {
+				return false
+			}
+			return wi.Text < wj.Text
+		})
+		tabContent := widget.NewVBox(fontItems...)
+		tabItems = append(tabItems, widget.NewTabItem(origin, tabContent))
+	}
 	if len(tabItems) > 0 {
 		sort.Slice(tabItems, func(i, j int) bool {
 			ii := tabItems[i]
@@ -434,7 +654,60 @@ func (a *App) uploadFont() {
 	}
 }
 
-func (a *App) uploadFontData(r io.Reader) {
+func (a *App) composeFont() {
+	newFontComposeDialog(a)
+}
+
+// lintFont checks the given font data and, if any issues are found,
+// asks the user for confirmation before calling upload.
+func (a *App) lintFont(data []byte, symbols *fonts.SymbolMap, upload func()) {
+	const (
+		maxDisplayedIssues = 10
+	)
+	dec, err := mcm.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	issues := fonts.Lint(dec, symbols)
+	if len(issues) == 0 {
+		upload()
+		return
+	}
+	var lines []string
+	for ii, v := range issues {
+		if ii == maxDisplayedIssues {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(issues)-ii))
+			break
+		}
+		lines = append(lines, v.String())
+	}
+	lines = append(lines, "", "Upload anyway?")
+	title := "Font has warnings"
+	if fonts.LintHasErrors(issues) {
+		title = "Font has errors"
+	}
+	dialog.ShowConfirm(title, strings.Join(lines, "\n"), func(ok bool) {
+		if ok {
+			upload()
+		}
+	}, a.window)
+}
+
+// uploadFontData uploads the given font after linting it against
+// the given symbols, which might be nil.
+func (a *App) uploadFontData(r io.Reader, symbols *fonts.SymbolMap) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	a.lintFont(data, symbols, func() {
+		a.uploadLintedFontData(bytes.NewReader(data))
+	})
+}
+
+func (a *App) uploadLintedFontData(r io.Reader) {
 	prog := dialog.NewProgressInfinite("Uploading Font...", "", a.window)
 	prog.Show()
 	err := a.osd.UploadFont(r, func(done, total int) {
@@ -456,7 +729,7 @@ func (a *App) uploadFontData(r io.Reader) {
 	prog.Hide()
 }
 
-func (a *App) uploadFontFilename(filename string) {
+func (a *App) uploadFontFilename(filename string, symbols *fonts.SymbolMap) {
 	if a.uploadFontDialog != nil {
 		a.uploadFontDialog.Hide()
 		a.uploadFontDialog = nil
@@ -467,7 +740,7 @@ func (a *App) uploadFontFilename(filename string) {
 		return
 	}
 	defer f.Close()
-	a.uploadFontData(f)
+	a.uploadFontData(f, symbols)
 }
 
 func (a *App) uploadFontFileDialog() {
@@ -479,26 +752,170 @@ func (a *App) uploadFontFileDialog() {
 		}
 		return
 	}
-	a.uploadFontFilename(filename)
+	a.uploadFontFilename(filename, nil)
 }
 
-func (a *App) flashFirmware(r io.Reader) {
-	prog := dialog.NewProgressInfinite("Flashing...", "", a.window)
+func (a *App) uploadLogo() {
+	filename, err := dlgs.File().Filter("Image (*.png)", "png").Load()
+	platformAfterFileDialog()
+	if err != nil {
+		if err != dlgs.ErrCancelled {
+			a.showError(err)
+		}
+		return
+	}
+	im, err := fonts.DecodeImageFile(filename)
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	var logoItems []fyne.CanvasObject
+	for _, logo := range fonts.Logos() {
+		logo := logo
+		logoItems = append(logoItems, widget.NewButton(logo.Name, func() {
+			if a.uploadLogoDialog != nil {
+				a.uploadLogoDialog.Hide()
+				a.uploadLogoDialog = nil
+			}
+			a.uploadLogoImage(logo, im)
+		}))
+	}
+	a.uploadLogoDialog = dialog.ShowCustom("Select Logo", "Cancel", widget.NewVBox(logoItems...), a.window)
+}
+
+func (a *App) uploadLogoImage(logo *fonts.Logo, im image.Image) {
+	chars, err := logo.Chars(im)
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	prog := dialog.NewProgressInfinite("Uploading Logo...", "", a.window)
 	prog.Show()
-	err := a.osd.FlashFirmware(r, func(done int, total int) {
-		prog.UpdateMessage(fmt.Sprintf("%03d/%03d bytes written...", done, total))
+	err = a.osd.UploadFontChars(chars, func(done, total int) {
+		prog.UpdateMessage(fmt.Sprintf("Writing logo (%03d/%03d)...", done, total))
 	})
 	prog.Hide()
 	if err != nil {
 		a.showError(err)
 		return
 	}
-	info, err := a.osd.Info()
+	for idx, chr := range chars {
+		if idx < len(a.fontItems) {
+			a.fontItems[idx].SetFontData(chr.Data()[:mcm.MinCharBytes])
+		}
+	}
+	a.fontBrowser.Refresh()
+}
+
+// flashFirmware loads the firmware file read from r, which might be
+// in any of the supported formats, validates it and flashes it. If
+// validation fails, the user is asked for confirmation. If f is non-nil,
+// it's used to check the version in the image.
+func (a *App) flashFirmware(name string, r io.Reader, f *firmware.Firmware) {
+	fw, err := firmware.Decode(name, r)
 	if err != nil {
 		a.showError(err)
 		return
 	}
-	a.setInfo(info)
+	if f == nil && fw.ReleaseNotes != "" {
+		// Release bundle with notes, show them before flashing
+		title := fmt.Sprintf("Release Notes for %s", name)
+		dialog.ShowCustomConfirm(title, "Flash", "Cancel", newReleaseNotesView(fw.ReleaseNotes), func(ok bool) {
+			if ok {
+				a.flashFirmwareFile(fw, nil)
+			}
+		}, a.window)
+		return
+	}
+	a.flashFirmwareFile(fw, f)
+}
+
+// flashFirmwareFile validates the decoded firmware and flashes it.
+// See flashFirmware.
+func (a *App) flashFirmwareFile(fw *firmware.File, f *firmware.Firmware) {
+	data := fw.Data
+	img, err := firmware.ParseImage(data)
+	if err == nil && f != nil {
+		err = img.CheckVersion(f)
+	}
+	if err != nil {
+		ie, ok := err.(*firmware.ImageError)
+		if !ok {
+			a.showError(err)
+			return
+		}
+		lines := []string{"This file doesn't look like a valid firmware for the OSD:"}
+		for _, p := range ie.Problems {
+			lines = append(lines, "- "+p)
+		}
+		lines = append(lines, "", "Flashing it might leave the OSD stuck in bootloader mode.", "Flash anyway?")
+		dialog.ShowConfirm("Invalid firmware", strings.Join(lines, "\n"), func(ok bool) {
+			if ok {
+				a.flashFirmwareData(data, true)
+			}
+		}, a.window)
+		return
+	}
+	a.flashFirmwareData(data, false)
+}
+
+// pendingFirmwarePath returns the path where the firmware being
+// flashed is stored until flashing finishes, so it can be resumed
+// if it fails.
+func (a *App) pendingFirmwarePath() string {
+	return a.storagePath(path.Join(firmwareCacheDir, pendingFirmwareFile))
+}
+
+// flashFirmwareData flashes the given firmware, which is rejected
+// if it's not a valid image unless force is true
+func (a *App) flashFirmwareData(data []byte, force bool) {
+	p := a.pendingFirmwarePath()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			log.Warnf("could not save pending firmware: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var prog *dialog.ProgressDialog
+	prog = dialog.NewProgressWithCancel("Flashing...", "", func() {
+		prog.UpdateMessage("Cancelling...")
+		cancel()
+	}, a.window)
+	prog.Show()
+	// Flash in the background, otherwise the cancel button
+	// wouldn't get any events until flashing finishes
+	go func() {
+		defer cancel()
+		err := a.osd.FlashFirmwareWithOptions(ctx, bytes.NewReader(data), &frskyosd.FlashOptions{
+			Validate: firmware.Validate,
+			Force:    force,
+			Progress: func(p *frskyosd.FlashProgress) {
+				prog.UpdateMessage(p.String())
+				prog.SetValue(p.Fraction())
+			},
+		})
+		prog.Hide()
+		if err == context.Canceled {
+			// Flashing stopped between chunks, the OSD is still in
+			// bootloader mode and the pending firmware is kept.
+			if info, err := a.osd.Info(); err == nil {
+				a.setInfo(info)
+			}
+			a.showBootloaderMode()
+			return
+		}
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		os.Remove(p)
+		info, err := a.osd.Info()
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		a.setInfo(info)
+	}()
 }
 
 func (a *App) showFirmwareLoadingError(err error) {
@@ -510,11 +927,47 @@ func (a *App) showFirmwareLoadingError(err error) {
 	dlg.Show()
 }
 
+// firmwareSources returns the configured firmware sources. They're read
+// from the FRSKY_OSD_FIRMWARE_SOURCES environment variable or, if it's
+// not set, from ~/.frskyosd/firmware-sources, one per line. If none
+// are configured, the default ones are used.
+func (a *App) firmwareSources() ([]firmware.Source, error) {
+	spec := os.Getenv("FRSKY_OSD_FIRMWARE_SOURCES")
+	if spec == "" {
+		data, err := ioutil.ReadFile(a.storagePath(firmwareSourcesFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		spec = string(data)
+	}
+	sources, err := firmware.ParseSources(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		sources = firmware.DefaultSources()
+	}
+	return sources, nil
+}
+
+// loadFirmwares returns the firmwares available in the configured
+// sources, including the ones in the cache.
+func (a *App) loadFirmwares() ([]*firmware.Firmware, error) {
+	sources, err := a.firmwareSources()
+	if err != nil {
+		return nil, err
+	}
+	// Previously used firmwares are always available, even
+	// if the other sources can't be reached.
+	sources = append(sources, a.firmwareCache)
+	return firmware.LoadFrom(context.Background(), sources)
+}
+
 func (a *App) selectFirmware() {
 	progress := dialog.NewProgressInfinite("Updating", "Check for firmware updates", a.window)
 	progress.Show()
 	go func() {
-		firmwares, err := firmware.Load()
+		firmwares, err := a.loadFirmwares()
 		if err != nil {
 			progress.Hide()
 			a.showFirmwareLoadingError(err)
@@ -525,24 +978,45 @@ func (a *App) selectFirmware() {
 			a.showFirmwareLoadingError(errors.New("no firmwares found"))
 			return
 		}
-		a.selectFirmwareDialog = newFirmwaresDialog(firmwares, a.window)
-		a.selectFirmwareDialog.OnFirmwareSelected = func(f *firmware.Firmware) {
-			a.selectFirmwareEntry(f)
-		}
+		a.selectFirmwareDialog = newFirmwaresDialog(firmwares, a.installedFirmwareVersion(), a.window)
+		a.selectFirmwareDialog.OnFirmwareSelected = a.confirmFirmwareEntry
 		a.selectFirmwareDialog.OnSelectFile = a.selectFirmwareFile
+		a.selectFirmwareDialog.OnReleaseNotes = a.showFirmwareReleaseNotes
 		progress.Hide()
 		a.selectFirmwareDialog.Show()
 	}()
 }
 
+// confirmFirmwareEntry asks the user for confirmation before
+// downgrading the firmware, then flashes f.
+func (a *App) confirmFirmwareEntry(f *firmware.Firmware) {
+	installed := a.installedFirmwareVersion()
+	v, err := f.Version()
+	if installed == nil || err != nil || !v.Less(*installed) {
+		a.selectFirmwareEntry(f)
+		return
+	}
+	msg := fmt.Sprintf("The OSD is running firmware %s.\nFlashing %s will downgrade it. Continue?", installed, v)
+	dialog.ShowConfirm("Downgrade firmware", msg, func(ok bool) {
+		if ok {
+			a.selectFirmwareEntry(f)
+		}
+	}, a.window)
+}
+
 func (a *App) selectFirmwareEntry(f *firmware.Firmware) {
-	resp, err := http.Get(f.URL)
+	r, err := a.firmwareCache.Open(context.Background(), f)
 	if err != nil {
 		a.showError(err)
 		return
 	}
-	defer resp.Body.Close()
-	a.flashFirmware(resp.Body)
+	defer r.Close()
+	name, err := f.Filename()
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	a.flashFirmware(name, r, f)
 }
 
 func (a *App) selectFirmwareFile() {
@@ -550,7 +1024,7 @@ func (a *App) selectFirmwareFile() {
 		a.selectFirmwareDialog.Hide()
 		a.selectFirmwareDialog = nil
 	}
-	filename, err := dlgs.File().Filter("Firmware (*.bin)", "bin").Load()
+	filename, err := dlgs.File().Filter("Firmware (*.bin, *.hex, *.zip)", "bin", "hex", "zip").Load()
 	platformAfterFileDialog()
 	if err != nil {
 		if err != dlgs.ErrCancelled {
@@ -564,7 +1038,7 @@ func (a *App) selectFirmwareFile() {
 		return
 	}
 	defer f.Close()
-	a.flashFirmware(f)
+	a.flashFirmware(filepath.Base(filename), f, nil)
 }
 
 func (a *App) showError(err error) {
@@ -578,10 +1052,7 @@ func (a *App) showSettings() {
 	if a.window == nil {
 		return
 	}
-	if !a.isConnectedToV2() {
-		if a.window != nil {
-			dialog.ShowInformation("Version 2 required", settingsNotSupportedMessage, a.window)
-		}
+	if a.caps == nil || !a.caps.Settings {
 		return
 	}
 	a.settingsButton.Disable()
@@ -618,24 +1089,109 @@ func (a *App) showSettings() {
 	}()
 }
 
+// updatesSource returns the origin for app updates. It can be
+// overridden with the FRSKY_OSD_UPDATES_SOURCE environment variable
+// or the updates-source file in the storage directory, with either
+// a GitHub repository or the URL or path of a JSON release feed.
+func (a *App) updatesSource() (string, error) {
+	if origin := os.Getenv("FRSKY_OSD_UPDATES_SOURCE"); origin != "" {
+		return origin, nil
+	}
+	data, err := ioutil.ReadFile(a.storagePath(updatesSourceFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return updatesSource, nil
+		}
+		return "", err
+	}
+	if origin := strings.TrimSpace(string(data)); origin != "" {
+		return origin, nil
+	}
+	return updatesSource, nil
+}
+
 func (a *App) startAutoupdater() {
-	src, err := autoupdater.NewSource(updatesSource)
+	origin, err := a.updatesSource()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	src, err := autoupdater.NewSource(origin)
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
 	au, err := autoupdater.New(&autoupdater.Options{
 		Version:         appVersion,
-		AcceptPreleases: false,
-		NoSkipRelease:   true,
+		AcceptPreleases: a.prefs.AcceptsPrereleases(),
 		Source:          src,
 		Dialog:          a,
+		Store:           autoupdater.NewFileStore(a.storagePath(autoupdaterStoreFile)),
 	})
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
-	au.ScheduleCheckingForUpdates(12 * time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	a.autoupdater = au
+	a.stopAutoupdater = cancel
+	go au.ScheduleCheckingForUpdates(ctx, updatesCheckInterval)
+}
+
+// updateChannelChanged is called when the user selects another
+// channel for app updates. The selection is persisted and updates
+// are checked again, so switching to beta shows the newest
+// prerelease right away.
+func (a *App) updateChannelChanged(name string) {
+	channel := updateChannelStable
+	if name == updateChannelNames[1] {
+		channel = updateChannelBeta
+	}
+	if channel == a.prefs.UpdateChannel || (channel == updateChannelStable && a.prefs.UpdateChannel == "") {
+		return
+	}
+	a.prefs.UpdateChannel = channel
+	if err := a.savePreferences(a.prefs); err != nil {
+		a.showError(err)
+	}
+	if a.autoupdater != nil {
+		a.autoupdater.SetAcceptPrereleases(a.prefs.AcceptsPrereleases())
+		go func() {
+			if err := a.autoupdater.CheckForUpdates(context.Background()); err != nil {
+				log.Errorf("error checking for updates: %v", err)
+			}
+		}()
+	}
+}
+
+// acceptsBetaFirmware returns true iff the user opted in to be
+// notified about beta firmwares. It's safe to call from any
+// goroutine.
+func (a *App) acceptsBetaFirmware() bool {
+	return atomic.LoadUint32(&a.betaFirmware) != 0
+}
+
+func (a *App) setBetaFirmware(beta bool) {
+	var v uint32
+	if beta {
+		v = 1
+	}
+	atomic.StoreUint32(&a.betaFirmware, v)
+}
+
+// betaFirmwareChanged is called when the user toggles the beta
+// firmwares checkbox. The selection is persisted and, if there's
+// an OSD connected, firmware updates are checked again.
+func (a *App) betaFirmwareChanged(beta bool) {
+	a.setBetaFirmware(beta)
+	a.prefs.BetaFirmware = beta
+	if err := a.savePreferences(a.prefs); err != nil {
+		a.showError(err)
+	}
+	a.updateBanner.Hide()
+	if a.connected {
+		go a.adviseFirmwareUpdate(a.caps)
+	}
 }
 
 // ShowUpdaterDialog implements the autoupdater.Dialog interface
@@ -652,14 +1208,47 @@ func (a *App) ShowUpdaterDialog(opts *autoupdater.DialogOptions) {
 		return
 	}
 	title := fmt.Sprintf("Version %s is available", opts.AvailableRelease.Version)
-	confirmDialog := dialog.NewConfirm(title, msg, func(ok bool) {
-		if ok {
+	dismiss := autoupdater.DialogResponseCancel
+	if opts.AllowsResponse(autoupdater.DialogResponseRemindLater) {
+		dismiss = autoupdater.DialogResponseRemindLater
+	}
+	skipped := false
+	callback := func(ok bool) {
+		switch {
+		case skipped:
+			opts.Response(autoupdater.DialogResponseSkipRelease)
+		case ok:
 			opts.Response(resp)
-		} else {
-			opts.Response(autoupdater.DialogResponseCancel)
+		default:
+			opts.Response(dismiss)
+		}
+	}
+	var objs []fyne.CanvasObject
+	if notes := opts.AvailableRelease.Notes; notes != "" {
+		objs = append(objs, newReleaseNotesView(notes))
+	}
+	objs = append(objs, widget.NewLabel(msg))
+	var d dialog.Dialog
+	if opts.AllowsResponse(autoupdater.DialogResponseSkipRelease) {
+		skip := widget.NewButton(autoupdater.DialogResponseSkipRelease.String(), func() {
+			skipped = true
+			d.Hide()
+		})
+		objs = append(objs, widget.NewHBox(layout.NewSpacer(), skip, layout.NewSpacer()))
+	}
+	d = dialog.ShowCustomConfirm(title, "Yes", "No", widget.NewVBox(objs...), callback, a.window)
+}
+
+// ShowRestartDialog implements the autoupdater.Dialog interface
+func (a *App) ShowRestartDialog(opts *autoupdater.RestartDialogOptions) {
+	title := fmt.Sprintf("Version %s installed", opts.Version)
+	msg := "The update will be used the next time the app starts.\nRestart now?"
+	dialog.ShowConfirm(title, msg, func(ok bool) {
+		if ok && a.osd != nil {
+			a.osd.Close()
 		}
+		opts.Response(ok)
 	}, a.window)
-	confirmDialog.Show()
 }
 
 // Run starts the app
@@ -672,10 +1261,13 @@ func (a *App) Run() {
 			a.updateRemoteFonts()
 		}
 	}()
-	a.window.Resize(fyne.NewSize(516, 475))
+	a.window.Resize(fyne.NewSize(516, 640))
 	a.window.SetFixedSize(true)
-	go a.startAutoupdater()
+	a.startAutoupdater()
 	a.window.ShowAndRun()
+	if a.stopAutoupdater != nil {
+		a.stopAutoupdater()
+	}
 }
 
 const (
@@ -686,6 +1278,9 @@ const (
 func main() {
 	debug := flag.Bool("debug", false, "Set logging level to debug")
 	trace := flag.Bool("trace", false, "Set logging level to trace. Implies debug.")
+	betaFirmware := flag.Bool("beta-firmware", false, "Notify about beta firmware updates")
+	offline := flag.Bool("offline", false, "Don't access the network, use cached data only")
+	proxy := flag.String("proxy", "", "URL of the HTTP proxy to use")
 	flag.Parse()
 	if *trace || os.Getenv("FRSKY_OSD_TRACE") != "" {
 		log.SetLevel(log.TraceLevel)
@@ -694,8 +1289,18 @@ func main() {
 	} else {
 		log.SetLevel(log.InfoLevel)
 	}
+	httpConfig := httpclient.ConfigFromEnvironment()
+	httpConfig.CacheDir = storagePath(httpCacheDir)
+	httpConfig.Offline = httpConfig.Offline || *offline
+	if *proxy != "" {
+		httpConfig.Proxy = *proxy
+	}
+	httpclient.Configure(httpConfig)
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
 	platformSetup()
-	app := newApp()
+	app := newApp(*betaFirmware || os.Getenv("FRSKY_OSD_BETA_FIRMWARE") != "")
 	app.Run()
 }
 
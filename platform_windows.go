@@ -1,14 +1,12 @@
 package main
 
 import (
-	"net/http"
-
 	ieproxy "github.com/mattn/go-ieproxy"
 )
 
 func platformInit() {
+	// Proxies are read from the environment by httpclient
 	ieproxy.OverrideEnvWithStaticProxy()
-	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyFromEnvironment
 }
 
 func platformSetup()           {}
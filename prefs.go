@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"osdapp/internal/atomicfile"
+)
+
+const (
+	preferencesFile = "preferences.json"
+
+	updateChannelStable = "stable"
+	updateChannelBeta   = "beta"
+)
+
+// updateChannelNames are the user visible names for
+// each update channel, in the order they're displayed
+var updateChannelNames = []string{"Stable", "Beta"}
+
+// preferences are the user settings persisted between runs
+type preferences struct {
+	// UpdateChannel is either updateChannelStable or
+	// updateChannelBeta. Empty means stable.
+	UpdateChannel string `json:"update_channel,omitempty"`
+	// BetaFirmware indicates if the user opted in to be
+	// notified about beta firmwares
+	BetaFirmware bool `json:"beta_firmware,omitempty"`
+}
+
+// AcceptsPrereleases returns true iff the user opted in to
+// be notified about app prereleases
+func (p *preferences) AcceptsPrereleases() bool {
+	return p.UpdateChannel == updateChannelBeta
+}
+
+func (a *App) loadPreferences() (*preferences, error) {
+	var prefs preferences
+	data, err := ioutil.ReadFile(a.storagePath(preferencesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &prefs, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (a *App) savePreferences(prefs *preferences) error {
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(a.storagePath(preferencesFile), data, 0644)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/layout"
+	"fyne.io/fyne/widget"
+	dlgs "github.com/sqweek/dialog"
+
+	"osdapp/frskyosd"
+	"osdapp/internal/dialog"
+	"osdapp/internal/provision"
+)
+
+const (
+	provisioningPortsWidth  = 500
+	provisioningPortsHeight = 360
+)
+
+// provisioningTab applies a provisioning manifest to every
+// connected OSD at the same time
+type provisioningTab struct {
+	content       *widget.Box
+	manifestLabel *widget.Label
+	detailsLabel  *widget.Label
+	portsBox      *widget.Box
+	summaryLabel  *widget.Label
+	loadButton    *widget.Button
+	runButton     *widget.Button
+	stopButton    *widget.Button
+	reportButton  *widget.Button
+	statusLabels  map[string]*widget.Label
+	manifest      *provision.Manifest
+	// mu protects running, cancel and results, since they're
+	// also accessed from the provisioning goroutine
+	mu sync.Mutex
+	// running is true while OSDs are being provisioned
+	running bool
+	// cancel stops the provisioning in progress
+	cancel context.CancelFunc
+	// results are the results of the last provisioning
+	results []*provision.Result
+}
+
+func (a *App) newProvisioningTab() *provisioningTab {
+	t := &provisioningTab{}
+	t.manifestLabel = widget.NewLabel("None")
+	t.detailsLabel = widget.NewLabel("Load a manifest with the firmware, font\nand settings to apply to every OSD.")
+	t.portsBox = widget.NewVBox()
+	t.summaryLabel = widget.NewLabel("")
+	t.loadButton = widget.NewButton("Load Manifest", a.loadProvisioningManifest)
+	t.runButton = widget.NewButton("Provision All Ports", a.provisionAllPorts)
+	t.runButton.Disable()
+	t.stopButton = widget.NewButton("Stop", t.stop)
+	t.stopButton.Disable()
+	t.reportButton = widget.NewButton("Save Report", a.saveProvisioningReport)
+	t.reportButton.Disable()
+	scroll := widget.NewScrollContainer(t.portsBox)
+	ports := fyne.NewContainerWithLayout(layout.NewFixedGridLayout(fyne.NewSize(provisioningPortsWidth, provisioningPortsHeight)), scroll)
+	t.content = widget.NewVBox(
+		widget.NewHBox(
+			widget.NewLabel("Manifest:"),
+			t.manifestLabel,
+			layout.NewSpacer(),
+			t.loadButton,
+		),
+		t.detailsLabel,
+		ports,
+		layout.NewSpacer(),
+		widget.NewHBox(
+			t.summaryLabel,
+			layout.NewSpacer(),
+			t.reportButton,
+			t.stopButton,
+			t.runButton,
+		),
+	)
+	return t
+}
+
+// CanvasObject returns the object to be added to the window
+func (t *provisioningTab) CanvasObject() fyne.CanvasObject {
+	return t.content
+}
+
+// setManifest shows the manifest loaded from the file at p
+func (t *provisioningTab) setManifest(p string, m *provision.Manifest) {
+	t.manifest = m
+	t.manifestLabel.SetText(filepath.Base(p))
+	var lines []string
+	if m.Firmware != "" {
+		fw := m.Firmware
+		if filepath.IsAbs(fw) {
+			fw = filepath.Base(fw)
+		}
+		lines = append(lines, "Firmware: "+fw)
+	}
+	if m.Font != "" {
+		lines = append(lines, "Font: "+filepath.Base(m.Font))
+	}
+	if s := m.Settings; s != nil {
+		var settings []string
+		for _, v := range []struct {
+			name  string
+			value *int
+		}{
+			{"Brightness", s.Brightness},
+			{"Horizontal Offset", s.HorizontalOffset},
+			{"Vertical Offset", s.VerticalOffset},
+		} {
+			if v.value != nil {
+				settings = append(settings, fmt.Sprintf("%s %d", v.name, *v.value))
+			}
+		}
+		lines = append(lines, "Settings: "+strings.Join(settings, ", "))
+	}
+	t.detailsLabel.SetText(strings.Join(lines, "\n"))
+	t.runButton.Enable()
+}
+
+// setPorts shows one row per port, with its status
+func (t *provisioningTab) setPorts(ports []string) {
+	t.statusLabels = make(map[string]*widget.Label, len(ports))
+	rows := make([]fyne.CanvasObject, len(ports))
+	for ii, p := range ports {
+		status := widget.NewLabel("Waiting...")
+		t.statusLabels[p] = status
+		rows[ii] = widget.NewHBox(widget.NewLabel(p+":"), status)
+	}
+	t.portsBox.Children = rows
+	t.portsBox.Refresh()
+}
+
+func (t *provisioningTab) setStatus(port string, status string) {
+	if label := t.statusLabels[port]; label != nil {
+		label.SetText(status)
+	}
+}
+
+// isRunning returns true while OSDs are being provisioned
+func (t *provisioningTab) isRunning() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running
+}
+
+// lastResults returns the results of the last provisioning, or
+// nil if there are none
+func (t *provisioningTab) lastResults() []*provision.Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.results
+}
+
+func (t *provisioningTab) setResults(results []*provision.Result) {
+	t.mu.Lock()
+	t.results = results
+	t.mu.Unlock()
+}
+
+// setRunning updates the buttons for a provisioning that starts or
+// ends. While running, cancel is called when the user stops it.
+func (t *provisioningTab) setRunning(running bool, cancel context.CancelFunc) {
+	t.mu.Lock()
+	t.running = running
+	t.cancel = cancel
+	hasResults := t.results != nil
+	t.mu.Unlock()
+	for _, b := range []*widget.Button{t.loadButton, t.runButton, t.reportButton} {
+		setEnabled(b, !running)
+	}
+	setEnabled(t.stopButton, running)
+	if !running && !hasResults {
+		t.reportButton.Disable()
+	}
+}
+
+// stop cancels the provisioning in progress. OSDs that are being
+// flashed are left in bootloader mode.
+func (t *provisioningTab) stop() {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.mu.Unlock()
+	if cancel != nil {
+		t.stopButton.Disable()
+		t.summaryLabel.SetText("Stopping...")
+		cancel()
+	}
+}
+
+func (a *App) loadProvisioningManifest() {
+	filename, err := dlgs.File().Filter("Manifest (*.json)", "json").Load()
+	platformAfterFileDialog()
+	if err != nil {
+		if err != dlgs.ErrCancelled {
+			a.showError(err)
+		}
+		return
+	}
+	m, err := provision.LoadManifest(filename)
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	a.provisioning.setManifest(filename, m)
+}
+
+func (a *App) provisionAllPorts() {
+	t := a.provisioning
+	if t.manifest == nil || t.isRunning() {
+		return
+	}
+	if a.connected {
+		a.showError(errors.New("disconnect from the OSD before provisioning"))
+		return
+	}
+	ports, err := frskyosd.AvailablePorts()
+	if err != nil {
+		a.showError(err)
+		return
+	}
+	if len(ports) == 0 {
+		a.showError(errors.New("no ports found"))
+		return
+	}
+	sort.Strings(ports)
+	msg := fmt.Sprintf("Apply %s to the OSDs in %d ports?", t.manifestLabel.Text, len(ports))
+	dialog.ShowConfirm("Provision All Ports", msg, func(ok bool) {
+		if ok {
+			a.runProvisioning(ports)
+		}
+	}, a.window)
+}
+
+func (a *App) runProvisioning(ports []string) {
+	t := a.provisioning
+	t.setResults(nil)
+	t.summaryLabel.SetText("")
+	t.setPorts(ports)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.setRunning(true, cancel)
+	a.connectButton.Disable()
+	go func() {
+		defer func() {
+			cancel()
+			t.setRunning(false, nil)
+			a.portSelectionChanged(a.portsSelect.Selected)
+		}()
+		sources, err := a.firmwareSources()
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		t.summaryLabel.SetText("Preparing...")
+		plan, err := provision.Prepare(ctx, t.manifest, sources, a.firmwareCache)
+		if err != nil {
+			t.summaryLabel.SetText("")
+			if ctx.Err() == nil {
+				a.showError(err)
+			}
+			return
+		}
+		t.summaryLabel.SetText("Provisioning...")
+		results, err := plan.Run(ctx, &provision.Options{
+			Ports:    ports,
+			Progress: t.setStatus,
+		})
+		if err != nil {
+			t.summaryLabel.SetText("")
+			a.showError(err)
+			return
+		}
+		t.setResults(results)
+		s := provision.Summarize(results)
+		t.summaryLabel.SetText(fmt.Sprintf("%d passed, %d failed", s.Passed, s.Failed))
+	}()
+}
+
+func (a *App) saveProvisioningReport() {
+	results := a.provisioning.lastResults()
+	if results == nil {
+		return
+	}
+	filename, err := dlgs.File().Filter("Report (*.csv, *.json)", "csv", "json").Save()
+	platformAfterFileDialog()
+	if err != nil {
+		if err != dlgs.ErrCancelled {
+			a.showError(err)
+		}
+		return
+	}
+	if filepath.Ext(filename) == "" {
+		filename += ".csv"
+	}
+	if err := provision.WriteReport(filename, results); err != nil {
+		a.showError(err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"fyne.io/fyne/theme"
+	"fyne.io/fyne/widget"
+
+	"osdapp/firmware"
+	"osdapp/frskyosd"
+	"osdapp/internal/dialog"
+)
+
+const (
+	recoveryMessage = `The OSD is running its bootloader, which usually
+means there's no valid firmware loaded.
+Flash a firmware to recover it.`
+	eraseFirmwareMessage = `This will erase the OSD firmware, leaving only
+the bootloader. The OSD won't work until a new
+firmware is flashed. Continue?`
+)
+
+// showRecovery shows the recovery options for an OSD in bootloader
+// mode: flashing the newest available firmware, flashing a file or
+// erasing the firmware. Since the OSD is already running the
+// bootloader, flashing skips the initial reboot.
+func (a *App) showRecovery() {
+	var dlg dialog.Dialog
+	hide := func() {
+		if dlg != nil {
+			dlg.Hide()
+		}
+	}
+	latestButton := widget.NewButtonWithIcon("Looking for firmwares...", theme.MoveDownIcon(), nil)
+	latestButton.Disable()
+	fileButton := widget.NewButtonWithIcon("Flash a File", theme.FolderOpenIcon(), func() {
+		hide()
+		a.selectFirmwareFile()
+	})
+	eraseButton := widget.NewButtonWithIcon("Erase Firmware", theme.DeleteIcon(), func() {
+		hide()
+		dialog.ShowConfirm("Erase Firmware", eraseFirmwareMessage, func(ok bool) {
+			if ok {
+				a.eraseFirmware()
+			}
+		}, a.window)
+	})
+	content := widget.NewVBox(
+		widget.NewLabel(recoveryMessage),
+		latestButton,
+		fileButton,
+		eraseButton,
+	)
+	dlg = dialog.ShowCustom("OSD is in bootloader mode", "Close", content, a.window)
+	go func() {
+		firmwares, err := a.loadFirmwares()
+		var latest *firmware.Firmware
+		if err == nil {
+			latest = firmware.Newest(firmwares, a.acceptsBetaFirmware())
+		}
+		if latest == nil {
+			latestButton.SetText("No firmwares available")
+			return
+		}
+		latestButton.SetText(fmt.Sprintf("Flash %s (newest)", firmwareRecoveryName(latest)))
+		latestButton.OnTapped = func() {
+			hide()
+			a.selectFirmwareEntry(latest)
+		}
+		latestButton.Enable()
+	}()
+}
+
+// eraseFirmware erases the OSD firmware, leaving only the bootloader
+func (a *App) eraseFirmware() {
+	prog := dialog.NewProgressInfinite("Erasing...", "", a.window)
+	prog.Show()
+	// Erase in the background, so the UI keeps responding
+	go func() {
+		err := a.osd.FlashFirmwareWithOptions(context.Background(), nil, &frskyosd.FlashOptions{
+			Progress: func(p *frskyosd.FlashProgress) {
+				prog.UpdateMessage(p.String())
+			},
+		})
+		prog.Hide()
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		info, err := a.osd.Info()
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		a.setInfo(info)
+		a.clearFontItems()
+	}()
+}
+
+// firmwareRecoveryName returns the name shown for f in the
+// recovery options.
+func firmwareRecoveryName(f *firmware.Firmware) string {
+	if name, err := f.VersionName(); err == nil {
+		return name
+	}
+	if name, err := f.Filename(); err == nil {
+		return name
+	}
+	return f.URL
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/layout"
+	"fyne.io/fyne/widget"
+
+	"osdapp/firmware"
+	"osdapp/internal/dialog"
+	"osdapp/internal/markdown"
+)
+
+const (
+	// releaseNotesColumns is the number of characters per line,
+	// since labels don't wrap text by themselves
+	releaseNotesColumns = 64
+	releaseNotesWidth   = 480
+	releaseNotesHeight  = 320
+	noReleaseNotes      = "No release notes available"
+)
+
+// newReleaseNotesView returns a scrollable view rendering the
+// release notes in Markdown format.
+func newReleaseNotesView(notes string) fyne.CanvasObject {
+	var objs []fyne.CanvasObject
+	addLines := func(text string, prefix string, style fyne.TextStyle) {
+		indent := strings.Repeat(" ", len([]rune(prefix)))
+		for ii, line := range markdown.Wrap(text, releaseNotesColumns-len(prefix)) {
+			if ii == 0 {
+				line = prefix + line
+			} else {
+				line = indent + line
+			}
+			objs = append(objs, widget.NewLabelWithStyle(line, fyne.TextAlignLeading, style))
+		}
+	}
+	for _, b := range markdown.Parse(notes) {
+		switch b.Kind {
+		case markdown.Heading:
+			addLines(b.Plain(), "", fyne.TextStyle{Bold: true})
+		case markdown.Paragraph:
+			addLines(b.Plain(), "", fyne.TextStyle{})
+		case markdown.ListItem:
+			addLines(b.Plain(), strings.Repeat("  ", b.Level)+"• ", fyne.TextStyle{})
+		case markdown.Code:
+			for _, line := range strings.Split(b.Text, "\n") {
+				objs = append(objs, widget.NewLabelWithStyle(line, fyne.TextAlignLeading, fyne.TextStyle{Monospace: true}))
+			}
+		case markdown.Rule:
+			objs = append(objs, widget.NewLabel(strings.Repeat("─", releaseNotesColumns/2)))
+		}
+	}
+	if len(objs) == 0 {
+		objs = append(objs, widget.NewLabel(noReleaseNotes))
+	}
+	scroll := widget.NewScrollContainer(widget.NewVBox(objs...))
+	return fyne.NewContainerWithLayout(layout.NewFixedGridLayout(fyne.NewSize(releaseNotesWidth, releaseNotesHeight)), scroll)
+}
+
+// showReleaseNotes shows the given notes in a dialog
+func (a *App) showReleaseNotes(title string, notes string) {
+	dialog.ShowCustom(title, "Close", newReleaseNotesView(notes), a.window)
+}
+
+// showFirmwareReleaseNotes retrieves the release notes for the given
+// firmware, storing them in the cache, and shows them.
+func (a *App) showFirmwareReleaseNotes(f *firmware.Firmware) {
+	progress := dialog.NewProgressInfinite("Release Notes", "Loading release notes", a.window)
+	progress.Show()
+	go func() {
+		notes, err := a.firmwareCache.ReleaseNotes(context.Background(), f)
+		progress.Hide()
+		if err != nil {
+			a.showError(fmt.Errorf("could not load release notes: %v", err))
+			return
+		}
+		name, err := f.VersionName()
+		if err != nil {
+			name, _ = f.Filename()
+		}
+		a.showReleaseNotes(fmt.Sprintf("Firmware %s", name), notes)
+	}()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/layout"
+	"fyne.io/fyne/theme"
+	"fyne.io/fyne/widget"
+
+	"osdapp/firmware"
+)
+
+// updateBanner is a non-modal banner shown in the main window
+// when a firmware update is available for the connected OSD.
+type updateBanner struct {
+	box      *widget.Box
+	label    *widget.Label
+	notes    *widget.Button
+	flash    *widget.Button
+	dismiss  *widget.Button
+	firmware *firmware.Firmware
+	// OnFlash is called when the user taps the flash button
+	OnFlash func(f *firmware.Firmware)
+	// OnReleaseNotes is called when the user taps the release
+	// notes button
+	OnReleaseNotes func(f *firmware.Firmware)
+}
+
+func newUpdateBanner() *updateBanner {
+	b := &updateBanner{}
+	b.label = widget.NewLabel("")
+	b.notes = widget.NewButtonWithIcon("Release Notes", theme.InfoIcon(), b.showReleaseNotes)
+	b.flash = widget.NewButton("Flash", func() {
+		f := b.firmware
+		b.Hide()
+		if b.OnFlash != nil && f != nil {
+			b.OnFlash(f)
+		}
+	})
+	b.dismiss = widget.NewButtonWithIcon("", theme.CancelIcon(), b.Hide)
+	b.box = widget.NewHBox(b.label, layout.NewSpacer(), b.notes, b.flash, b.dismiss)
+	b.box.Hide()
+	return b
+}
+
+// CanvasObject returns the object to be added to the window
+func (b *updateBanner) CanvasObject() fyne.CanvasObject {
+	return b.box
+}
+
+// Show displays the banner for the given firmware
+func (b *updateBanner) Show(f *firmware.Firmware) {
+	b.firmware = f
+	name, err := f.VersionName()
+	if err != nil {
+		name, _ = f.Filename()
+	}
+	b.label.SetText(fmt.Sprintf("Firmware %s available", name))
+	if f.ReleaseNotesURL == "" {
+		b.notes.Disable()
+	} else {
+		b.notes.Enable()
+	}
+	b.box.Show()
+}
+
+// Hide hides the banner
+func (b *updateBanner) Hide() {
+	b.firmware = nil
+	b.box.Hide()
+}
+
+func (b *updateBanner) showReleaseNotes() {
+	if b.OnReleaseNotes != nil && b.firmware != nil {
+		b.OnReleaseNotes(b.firmware)
+	}
+}